@@ -0,0 +1,45 @@
+package main
+
+import (
+	gamelogic "github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// inputReader reads REPL commands from stdin on its own goroutine, so that
+// the REPL can wait for a command and for the session to end at once. A line
+// is only read when the REPL asks for one, so the prompt is never printed
+// ahead of a command's output, and a read still pending when the player
+// leaves a room is handed to the next room's REPL.
+type inputReader struct {
+	want    chan struct{}
+	lines   chan []string
+	pending bool
+}
+
+func newInputReader() *inputReader {
+	r := &inputReader{
+		want:  make(chan struct{}),
+		lines: make(chan []string),
+	}
+	go func() {
+		for range r.want {
+			r.lines <- gamelogic.GetInput()
+		}
+	}()
+	return r
+}
+
+// next asks for the next command, unless it was already asked for, and
+// returns the channel it arrives on. The caller must call received once it
+// has it.
+func (r *inputReader) next() <-chan []string {
+	if !r.pending {
+		r.want <- struct{}{}
+		r.pending = true
+	}
+	return r.lines
+}
+
+// received notes that the command asked for has been read.
+func (r *inputReader) received() {
+	r.pending = false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	gamelogic "github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	routing "github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	store "github.com/bootdotdev/learn-pub-sub-starter/internal/store"
+)
+
+func main() {
+	mapPath := flag.String("map", "", "path to the JSON world map the match was played on (defaults to the built-in map)")
+	room := flag.String("room", routing.DefaultRoom, "game room the match was played in")
+	storeKind := flag.String("store", "json", "where the players saved their armies: json, gob or sqlite")
+	storePath := flag.String("store-path", "", "state directory for json/gob or database file for sqlite")
+	users := flag.String("users", "", "comma-separated players whose event logs to replay")
+	until := flag.String("until", "", "stop replaying at this RFC3339 time")
+	flag.Parse()
+
+	if *users == "" {
+		fmt.Println("usage: replay -users <player>[,<player>...] [-room <room>] [-store <kind>] [-until <time>]")
+		os.Exit(1)
+	}
+
+	var untilTime time.Time
+	if *until != "" {
+		t, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			fmt.Printf("invalid -until time: %v\n", err)
+			os.Exit(1)
+		}
+		untilTime = t
+	}
+
+	if *mapPath != "" {
+		worldMap, err := gamelogic.LoadWorldMap(*mapPath)
+		if err != nil {
+			fmt.Printf("failed to load world map: %v\n", err)
+			os.Exit(1)
+		}
+		gamelogic.SetWorldMap(worldMap)
+	}
+
+	stateStore, err := store.Open(*storeKind, *storePath, *room)
+	if err != nil {
+		fmt.Printf("failed to open state store: %v\n", err)
+		os.Exit(1)
+	}
+	if stateStore == nil {
+		fmt.Println("nothing to replay without a state store")
+		os.Exit(1)
+	}
+	defer stateStore.Close()
+
+	// Replay from the first event rather than from a snapshot so that the
+	// whole match is shown.
+	logs := map[string][]gamelogic.Event{}
+	for _, username := range strings.Split(*users, ",") {
+		username = strings.TrimSpace(username)
+		if username == "" {
+			continue
+		}
+		events, err := stateStore.Events(username, 0)
+		if err != nil {
+			fmt.Printf("failed to read %s's events: %v\n", username, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: %v event(s)\n", username, len(events))
+		logs[username] = events
+	}
+
+	fmt.Printf("==== Replaying room %s ====\n", *room)
+	states := gamelogic.Replay(logs, untilTime)
+
+	names := []string{}
+	for username := range states {
+		names = append(names, username)
+	}
+	sort.Strings(names)
+	fmt.Println()
+	for _, username := range names {
+		gamelogic.PrintSnapshot(states[username])
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	auth "github.com/bootdotdev/learn-pub-sub-starter/internal/auth"
+	pubsub "github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	routing "github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// setupAuth answers login requests, signs the server's own messages and
+// rejects consumed messages that are not signed by a session of the player
+// they claim to come from. The public key is written to pubPath for clients
+// to pin.
+func setupAuth(keyPath, pubPath string, sessionTTL time.Duration) error {
+	key, err := auth.LoadOrCreateKey(keyPath)
+	if err != nil {
+		return err
+	}
+	err = auth.WritePublicKey(pubPath, key)
+	if err != nil {
+		return err
+	}
+	signer := auth.NewSigner(key, sessionTTL)
+	verifier, err := auth.NewVerifier(signer.PublicKey())
+	if err != nil {
+		return err
+	}
+	pubsub.SetMessageCheck(func(env pubsub.Envelope) error {
+		return verifier.CheckMessage(env.Token, env.Claimed, env.ServerOnly, env.Signed, env.Signature)
+	})
+
+	_, sessionKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	err = refreshServerToken(signer, sessionKey)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for range time.Tick(sessionTTL / 2) {
+			err := refreshServerToken(signer, sessionKey)
+			if err != nil {
+				fmt.Printf("failed to refresh server token: %v\n", err)
+			}
+		}
+	}()
+
+	// Login requests get an exchange of their own so that the broker can
+	// let players publish requests without letting them read any.
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	err = channel.ExchangeDeclare(routing.ExchangePerilLogin, amqp.ExchangeDirect, true, false, false, false, nil)
+	channel.Close()
+	if err != nil {
+		return err
+	}
+	return pubsub.ServeJSON(
+		conn,
+		routing.ExchangePerilLogin,
+		routing.LoginKey,
+		routing.LoginKey,
+		handlerLogin(signer),
+	)
+}
+
+// refreshServerToken issues a new token for the server's own messages, which
+// lets it forward moves on the players' behalf.
+func refreshServerToken(signer *auth.Signer, sessionKey ed25519.PrivateKey) error {
+	token, err := signer.IssueServer(sessionKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		return err
+	}
+	pubsub.SetSession(token, sessionKey)
+	return nil
+}
+
+// Handler function to execute when login requests are consumed. The broker
+// has already authenticated the player: a request is only accepted from the
+// broker user of the same name.
+func handlerLogin(signer *auth.Signer) func(string, routing.LoginRequest) routing.LoginResponse {
+	return func(userID string, req routing.LoginRequest) routing.LoginResponse {
+		defer fmt.Print("> ")
+
+		err := routing.ValidateUsername(req.Username)
+		if err != nil {
+			return routing.LoginResponse{Error: err.Error()}
+		}
+		if userID != req.Username {
+			fmt.Printf("\nrejected login for %s from broker user %q\n", req.Username, userID)
+			return routing.LoginResponse{Error: "log in with the broker credentials of " + req.Username}
+		}
+
+		token, err := signer.Issue(req.Username, req.SigningKey)
+		if err != nil {
+			fmt.Printf("\nfailed to issue token for %s: %v\n", req.Username, err)
+			return routing.LoginResponse{Error: "login failed, try again later"}
+		}
+		fmt.Printf("\n%s logged in\n", req.Username)
+		return routing.LoginResponse{
+			Token: token,
+		}
+	}
+}
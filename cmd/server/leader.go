@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	pubsub "github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	routing "github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// A follower tries to take over every leaderRetry, and the leader announces
+// itself every leaderHeartbeat. A leader not heard from for leaderTimeout is
+// shown as unknown.
+const (
+	leaderRetry     = 2 * time.Second
+	leaderHeartbeat = time.Second
+	leaderTimeout   = 5 * time.Second
+)
+
+// election decides which of the servers sharing the broker performs the
+// authoritative duties: running rooms, their clocks and the REPL commands
+// that publish to players. Only one connection can hold an exclusive queue
+// and the broker deletes it when that connection closes, so the server that
+// declares the lock queue leads until it goes away and a follower takes
+// over.
+//
+// Rooms live only in the leader's memory and are not replicated. A server
+// taking over creates the default room afresh: its match starts over and
+// every other room, with its match and ledger, is lost. Players keep their
+// own game state and the rooms' durable queues keep the messages published
+// in the meantime.
+type election struct {
+	id       string
+	leading  bool
+	leaderID string
+	since    time.Time
+	lastSeen time.Time
+	mu       *sync.Mutex
+}
+
+// leader is this server's view of the election.
+var leader *election
+
+// startElection follows the leader's heartbeats and campaigns in the
+// background. onElected is called whenever this server becomes the leader
+// and onDeposed whenever it loses the lock, after which it campaigns again.
+func startElection(id string, onElected, onDeposed func()) (*election, error) {
+	e := &election{
+		id: id,
+		mu: &sync.Mutex{},
+	}
+	err := pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		routing.LeaderKey+"."+id,
+		routing.LeaderKey,
+		pubsub.Transient,
+		e.handlerHeartbeat(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	go e.campaign(onElected, onDeposed)
+	return e, nil
+}
+
+// campaign tries to take the lock queue, leads for as long as it holds it,
+// and tries again once it is lost.
+func (e *election) campaign(onElected, onDeposed func()) {
+	for {
+		channel, err := conn.Channel()
+		if err == nil {
+			_, err = channel.QueueDeclare(routing.LeaderLockQueue, false, true, true, false, nil)
+			if err == nil {
+				e.mu.Lock()
+				e.leading = true
+				e.leaderID = e.id
+				e.since = time.Now()
+				e.lastSeen = e.since
+				e.mu.Unlock()
+
+				fmt.Printf("\nthis server (%s) is now the leader\n", e.id)
+				onElected()
+				fmt.Print("> ")
+				e.heartbeat(channel)
+
+				e.mu.Lock()
+				e.leading = false
+				e.mu.Unlock()
+				fmt.Println("\nlost the leader lock, stepping down")
+				onDeposed()
+				fmt.Print("> ")
+				continue
+			}
+			// The broker closes the channel when the queue is locked.
+			channel.Close()
+		}
+		time.Sleep(leaderRetry)
+	}
+}
+
+// heartbeat announces the leader until its channel closes.
+func (e *election) heartbeat(channel *amqp.Channel) {
+	ticker := time.NewTicker(leaderHeartbeat)
+	defer ticker.Stop()
+	for range ticker.C {
+		if channel.IsClosed() {
+			return
+		}
+		e.mu.Lock()
+		hb := routing.LeaderHeartbeat{ID: e.id, Since: e.since}
+		e.mu.Unlock()
+
+		ch, err := conn.Channel()
+		if err != nil {
+			continue
+		}
+		err = pubsub.PublishJSON(ch, routing.ExchangePerilDirect, routing.LeaderKey, hb)
+		ch.Close()
+		if err != nil {
+			fmt.Printf("failed to publish leader heartbeat: %v\n", err)
+		}
+	}
+}
+
+// Handler function to execute when leader heartbeats are consumed.
+func (e *election) handlerHeartbeat() func(routing.LeaderHeartbeat) pubsub.AckType {
+	return func(hb routing.LeaderHeartbeat) pubsub.AckType {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.leaderID = hb.ID
+		e.since = hb.Since
+		e.lastSeen = time.Now()
+		return pubsub.Ack
+	}
+}
+
+// isLeader reports whether this server performs the authoritative duties.
+func (e *election) isLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// requireLeader reports whether this server leads, telling the user who
+// does when it does not.
+func (e *election) requireLeader() bool {
+	if e.isLeader() {
+		return true
+	}
+	fmt.Printf("this server is a follower; run the command on the leader (%s)\n", e.currentLeader())
+	return false
+}
+
+// currentLeader describes the last leader heard from.
+func (e *election) currentLeader() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leaderID == "" || time.Since(e.lastSeen) > leaderTimeout {
+		return "unknown"
+	}
+	return e.leaderID
+}
+
+// printStatus prints this server's role and the current leader.
+func (e *election) printStatus() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	role := "follower"
+	if e.leading {
+		role = "leader"
+	}
+	fmt.Printf("server: %s (%s)\n", e.id, role)
+	if e.leaderID == "" {
+		fmt.Println("leader: unknown, no heartbeat yet")
+		return
+	}
+	fmt.Printf("leader: %s since %s\n", e.leaderID, e.since.Format("15:04:05"))
+	if !e.leading {
+		age := time.Since(e.lastSeen).Round(time.Second)
+		fmt.Printf("last heartbeat: %v ago", age)
+		if age > leaderTimeout {
+			fmt.Print(" (leader may be down; a follower will take over)")
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	pubsub "github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	ratelimit "github.com/bootdotdev/learn-pub-sub-starter/internal/ratelimit"
+	routing "github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	store "github.com/bootdotdev/learn-pub-sub-starter/internal/store"
+)
+
+// Game logs are accepted from a player logBurst at once and logBurst per
+// logPeriod on average. A message a player already logged duplicateBurst
+// times within duplicateWindow is dropped, so that a few legitimate repeats,
+// such as the same war result, still get through.
+const (
+	logBurst        = 20
+	logPeriod       = 10 * time.Second
+	duplicateBurst  = 3
+	duplicateWindow = 10 * time.Second
+)
+
+// logOffender counts the logs dropped from a player.
+type logOffender struct {
+	Username    string
+	Throttled   int
+	Duplicates  int
+	Banned      bool
+	LastOffense time.Time
+}
+
+// logGuard decides which game logs are written, dropping floods, repeats
+// and anything from banned players.
+type logGuard struct {
+	limiter *ratelimit.KeyedLimiter
+	// seen holds when each player logged each message within the
+	// duplicate window, oldest first.
+	seen      map[string]map[string][]time.Time
+	offenders map[string]*logOffender
+	// bans persists bans across restarts. It is nil when bans are only
+	// kept in memory.
+	bans *store.BanStore
+	mu   *sync.Mutex
+}
+
+// newLogGuard creates a guard with the bans recorded in bans, which may be
+// nil.
+func newLogGuard(bans *store.BanStore) (*logGuard, error) {
+	g := &logGuard{
+		limiter:   ratelimit.NewKeyedLimiter(logBurst, logPeriod),
+		seen:      map[string]map[string][]time.Time{},
+		offenders: map[string]*logOffender{},
+		bans:      bans,
+		mu:        &sync.Mutex{},
+	}
+	if bans == nil {
+		return g, nil
+	}
+	banned, err := bans.Banned()
+	if err != nil {
+		return nil, err
+	}
+	for _, username := range banned {
+		g.record(username).Banned = true
+	}
+	return g, nil
+}
+
+// admit reports whether gamelog should be written, and why not when it
+// should be dropped.
+func (g *logGuard) admit(gamelog routing.GameLog) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	offender := g.offenders[gamelog.Username]
+	if offender != nil && offender.Banned {
+		return "banned", false
+	}
+
+	now := time.Now()
+	seen, ok := g.seen[gamelog.Username]
+	if !ok {
+		seen = map[string][]time.Time{}
+		g.seen[gamelog.Username] = seen
+	}
+	for message, times := range seen {
+		for len(times) > 0 && now.Sub(times[0]) > duplicateWindow {
+			times = times[1:]
+		}
+		if len(times) == 0 {
+			delete(seen, message)
+			continue
+		}
+		seen[message] = times
+	}
+	if len(seen[gamelog.Message]) >= duplicateBurst {
+		g.offender(gamelog.Username, now).Duplicates++
+		return "duplicate", false
+	}
+	seen[gamelog.Message] = append(seen[gamelog.Message], now)
+
+	if !g.limiter.Allow(gamelog.Username) {
+		g.offender(gamelog.Username, now).Throttled++
+		return "rate limited", false
+	}
+	return "", true
+}
+
+// record returns the record of username, creating it if needed. The caller
+// must hold g.mu.
+func (g *logGuard) record(username string) *logOffender {
+	offender, ok := g.offenders[username]
+	if !ok {
+		offender = &logOffender{Username: username}
+		g.offenders[username] = offender
+	}
+	return offender
+}
+
+// offender returns the record of username and notes an offense at now. The
+// caller must hold g.mu.
+func (g *logGuard) offender(username string, now time.Time) *logOffender {
+	offender := g.record(username)
+	offender.LastOffense = now
+	return offender
+}
+
+// forget drops the latest sighting of gamelog from the duplicate window, so
+// that it is admitted again when it is redelivered after failing to be
+// written.
+func (g *logGuard) forget(gamelog routing.GameLog) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	seen := g.seen[gamelog.Username]
+	times := seen[gamelog.Message]
+	if len(times) == 0 {
+		return
+	}
+	seen[gamelog.Message] = times[:len(times)-1]
+}
+
+// isBanned reports whether username is banned.
+func (g *logGuard) isBanned(username string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	offender, ok := g.offenders[username]
+	return ok && offender.Banned
+}
+
+// setBanned bans or unbans username, recording the change in the ban store
+// when there is one.
+func (g *logGuard) setBanned(username string, banned bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.bans != nil {
+		var err error
+		if banned {
+			err = g.bans.Ban(username)
+		} else {
+			err = g.bans.Unban(username)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	g.record(username).Banned = banned
+	return nil
+}
+
+// publishBan announces a ban, or its lifting, to every server, this one
+// included.
+func publishBan(ban routing.LogBan) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+	return pubsub.PublishJSON(channel, routing.ExchangePerilDirect, routing.BanKey, ban)
+}
+
+// list returns every player with dropped logs or a ban, worst first.
+func (g *logGuard) list() []logOffender {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	offenders := []logOffender{}
+	for _, offender := range g.offenders {
+		offenders = append(offenders, *offender)
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		a := offenders[i].Throttled + offenders[i].Duplicates
+		b := offenders[j].Throttled + offenders[j].Duplicates
+		if a != b {
+			return a > b
+		}
+		return offenders[i].Username < offenders[j].Username
+	})
+	return offenders
+}
+
+// printAbusers prints the players whose logs were dropped.
+func (g *logGuard) printAbusers() {
+	offenders := g.list()
+	if len(offenders) == 0 {
+		fmt.Println("no abusive players")
+		return
+	}
+	for _, o := range offenders {
+		banned := ""
+		if o.Banned {
+			banned = " [banned]"
+		}
+		last := "never"
+		if !o.LastOffense.IsZero() {
+			last = o.LastOffense.Format("15:04:05")
+		}
+		fmt.Printf("* %s: %v throttled, %v duplicate, last at %s%s\n", o.Username, o.Throttled, o.Duplicates, last, banned)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	routing "github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	store "github.com/bootdotdev/learn-pub-sub-starter/internal/store"
+)
+
+// logsLimit is the most logs a query prints.
+const logsLimit = 50
+
+// commandLogs runs the logs REPL command against the log index.
+func commandLogs(idx *store.LogIndex, words []string) {
+	if idx == nil {
+		fmt.Println("the log index is disabled")
+		return
+	}
+	if len(words) < 3 {
+		fmt.Println("usage: logs user <player> | logs since <duration> | logs grep <text>")
+		return
+	}
+
+	var gamelogs []routing.GameLog
+	var err error
+	switch words[1] {
+	case "user":
+		gamelogs, err = idx.ByUser(words[2], logsLimit)
+	case "since":
+		d, parseErr := time.ParseDuration(words[2])
+		if parseErr != nil {
+			fmt.Printf("invalid duration %q: %v\n", words[2], parseErr)
+			return
+		}
+		gamelogs, err = idx.Since(time.Now().Add(-d), logsLimit)
+	case "grep":
+		gamelogs, err = idx.Grep(strings.Join(words[2:], " "), logsLimit)
+	default:
+		fmt.Println("usage: logs user <player> | logs since <duration> | logs grep <text>")
+		return
+	}
+	if err != nil {
+		fmt.Printf("failed to query logs: %v\n", err)
+		return
+	}
+
+	if len(gamelogs) == 0 {
+		fmt.Println("no matching logs")
+		return
+	}
+	for _, gamelog := range gamelogs {
+		fmt.Printf("%v %v: %v\n", gamelog.CurrentTime.Local().Format(time.RFC3339), gamelog.Username, gamelog.Message)
+	}
+	if len(gamelogs) == logsLimit {
+		fmt.Printf("(showing the latest %v)\n", logsLimit)
+	}
+}
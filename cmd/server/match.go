@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	gamelogic "github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	pubsub "github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	routing "github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// announceIfFinished publishes the final match event when an observation
+// finished the match.
+func (r *room) announceIfFinished(ev routing.MatchEvent, finished bool) {
+	if finished {
+		r.publishMatchEventOrLog(ev)
+	}
+}
+
+// handlerWar follows the units lost in every war so that eliminations are
+// noticed.
+func (r *room) handlerWar() func(rw gamelogic.RecognitionOfWar) pubsub.AckType {
+	return func(rw gamelogic.RecognitionOfWar) pubsub.AckType {
+		r.announceIfFinished(r.match.ObserveWar(rw))
+		return pubsub.Ack
+	}
+}
+
+// runMatchClock checks the match time limit once a second until the match
+// is finished.
+func (r *room) runMatchClock() {
+	for r.match.Phase() != routing.MatchFinished {
+		if !r.sleep(time.Second) {
+			return
+		}
+		r.announceIfFinished(r.match.CheckTime())
+	}
+}
+
+// publishMatchEvent broadcasts a match event to the room.
+func (r *room) publishMatchEvent(ev routing.MatchEvent) error {
+	channel, err := r.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+	return pubsub.PublishJSON(channel, routing.ExchangePerilDirect, r.key(routing.MatchKey), ev)
+}
+
+// publishMatchEventOrLog publishes ev, printing it on the server, and only
+// reports a failure since it is called from handlers and the REPL alike.
+func (r *room) publishMatchEventOrLog(ev routing.MatchEvent) {
+	fmt.Printf("match in %s is now %s\n", r.id, ev.Phase)
+	if ev.Phase == routing.MatchFinished {
+		fmt.Printf("winner: %q (%s)\n", ev.Winner, ev.Reason)
+	}
+	err := r.publishMatchEvent(ev)
+	if err != nil {
+		fmt.Printf("failed to publish match event: %v\n", err)
+	}
+}
+
+// printMatch prints the match phase and every player's score.
+func (r *room) printMatch() {
+	ev := r.match.Event()
+	fmt.Printf("The match in %s is %s.\n", r.id, ev.Phase)
+	if ev.Phase == routing.MatchFinished {
+		fmt.Printf("%s won: %s.\n", ev.Winner, ev.Reason)
+	}
+	for _, s := range r.match.Scores() {
+		fmt.Printf("* %s: score %v (%v territories, power %v)\n", s.Username, s.Score, s.Territories, s.Power)
+	}
+}
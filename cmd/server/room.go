@@ -0,0 +1,644 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	gamelogic "github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	pubsub "github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	ratelimit "github.com/bootdotdev/learn-pub-sub-starter/internal/ratelimit"
+	routing "github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Transcripts accept chatTranscriptBurst messages at once from a player and
+// chatTranscriptBurst per chatTranscriptPeriod on average.
+const (
+	chatTranscriptBurst  = 10
+	chatTranscriptPeriod = 10 * time.Second
+)
+
+// roomConfig holds the settings every room is created with.
+type roomConfig struct {
+	BrokerURL     string
+	RoundLength   time.Duration
+	TickInterval  time.Duration
+	Authoritative bool
+	Lobby         bool
+	Conditions    gamelogic.WinConditions
+}
+
+// room is a single game running on the shared broker. Every routing key and
+// queue it uses is scoped with its ID, so rooms never see each other's
+// messages.
+type room struct {
+	id    string
+	match *gamelogic.Match
+	// chatLimiter drops transcript lines from players who flood the chat.
+	chatLimiter *ratelimit.KeyedLimiter
+	// ledger is the authoritative record of player resources. It is nil
+	// unless the server was started with -authoritative.
+	ledger *gamelogic.Ledger
+	// conn carries every consumer and publisher of the room, so that
+	// closing it stops them all.
+	conn *amqp.Connection
+	// done is closed when the room is stopped.
+	done chan struct{}
+	// offMap holds the players whose last map request named a different
+	// map than the server's. Their moves and spawns are discarded.
+	offMap   map[string]bool
+	offMapMu *sync.Mutex
+	// turnMode is set when the room is played in rounds. Players then give
+	// orders instead of moves; orders holds those given during round, while
+	// roundOpen is set.
+	turnMode  bool
+	orders    []gamelogic.ArmyOrder
+	round     int
+	roundOpen bool
+	ordersMu  *sync.Mutex
+}
+
+var (
+	roomsMu = &sync.Mutex{}
+	rooms   = map[string]*room{}
+)
+
+// createRoom subscribes to a new room's queues and starts its match.
+func createRoom(id string, config roomConfig) (*room, error) {
+	err := routing.ValidateRoom(id)
+	if err != nil {
+		return nil, err
+	}
+
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	if _, ok := rooms[id]; ok {
+		return nil, fmt.Errorf("room %s already exists", id)
+	}
+
+	r := &room{
+		id:          id,
+		match:       gamelogic.NewMatch(config.Conditions, config.Lobby),
+		chatLimiter: ratelimit.NewKeyedLimiter(chatTranscriptBurst, chatTranscriptPeriod),
+		done:        make(chan struct{}),
+		offMap:      map[string]bool{},
+		offMapMu:    &sync.Mutex{},
+		turnMode:    config.RoundLength > 0,
+		ordersMu:    &sync.Mutex{},
+	}
+	if config.Authoritative {
+		r.ledger = gamelogic.NewLedger()
+	}
+
+	r.conn, err = amqp.Dial(config.BrokerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// A room that fails to start is closed, so that none of its consumers
+	// outlive it.
+	err = r.subscribe()
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+
+	// Announce the map and match phase to clients that are already waiting.
+	err = r.publishWorldMap()
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+	err = r.publishMatchEvent(r.match.Event())
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+
+	if config.TickInterval > 0 {
+		go r.runTicks(config.TickInterval)
+	}
+	if config.RoundLength > 0 {
+		go r.runRounds(config.RoundLength)
+	}
+	if config.Conditions.TimeLimit > 0 {
+		go r.runMatchClock()
+	}
+
+	rooms[id] = r
+	return r, nil
+}
+
+// close stops the room's clocks and closes its connection, which cancels
+// its consumers.
+func (r *room) close() {
+	close(r.done)
+	r.conn.Close()
+}
+
+// sleep waits for d and reports whether the room is still open.
+func (r *room) sleep(d time.Duration) bool {
+	select {
+	case <-r.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// stopRooms closes every room and forgets them, for when this server is no
+// longer the leader.
+func stopRooms() {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	for id, r := range rooms {
+		r.close()
+		delete(rooms, id)
+	}
+}
+
+func getRoom(id string) (*room, bool) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	r, ok := rooms[id]
+	return r, ok
+}
+
+// listRooms returns every room ordered by ID.
+func listRooms() []*room {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	list := []*room{}
+	for _, r := range rooms {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+	return list
+}
+
+// key scopes a routing key or queue name to the room.
+func (r *room) key(key string) string {
+	return routing.RoomKey(r.id, key)
+}
+
+// subscribe creates the room's durable queues.
+func (r *room) subscribe() error {
+	// Follow moves to know which territories each player holds.
+	err := pubsub.SubscribeJSONContext(
+		r.conn,
+		routing.ExchangePerilTopic,
+		r.key(routing.ArmyMovesPrefix),
+		r.key(routing.ArmyMovesPrefix+".*"),
+		pubsub.Durable,
+		r.handlerMove(),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Collect the orders given during each round.
+	err = pubsub.SubscribeJSON(
+		r.conn,
+		routing.ExchangePerilTopic,
+		r.key(routing.ArmyOrdersPrefix),
+		r.key(routing.ArmyOrdersPrefix+".*"),
+		pubsub.Durable,
+		r.handlerOrder(),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Follow wars to know which units each player loses.
+	err = pubsub.SubscribeJSON(
+		r.conn,
+		routing.ExchangePerilTopic,
+		r.key(routing.MatchKey+"."+routing.WarRecognitionsPrefix),
+		r.key(routing.WarRecognitionsPrefix+".*"),
+		pubsub.Durable,
+		r.handlerWar(),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = pubsub.SubscribeJSONContext(
+		r.conn,
+		routing.ExchangePerilTopic,
+		r.key(routing.ArmySpawnsPrefix),
+		r.key(routing.ArmySpawnsPrefix+".*"),
+		pubsub.Durable,
+		r.handlerSpawn(),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Write every chat message, including whispers, to the transcript.
+	err = pubsub.SubscribeJSON(
+		r.conn,
+		routing.ExchangePerilTopic,
+		r.key(routing.ChatPrefix),
+		r.key(routing.ChatPrefix+".#"),
+		pubsub.Durable,
+		r.handlerChat(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return pubsub.SubscribeJSON(
+		r.conn,
+		routing.ExchangePerilTopic,
+		r.key(routing.WorldMapRequestPrefix),
+		r.key(routing.WorldMapRequestPrefix+".*"),
+		pubsub.Durable,
+		r.handlerWorldMapRequest(),
+	)
+}
+
+// publishPlayingState publishes a pause or resume message to the room.
+func (r *room) publishPlayingState(ps routing.PlayingState) error {
+	channel, err := r.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+	return pubsub.PublishJSON(channel, routing.ExchangePerilDirect, r.key(routing.PauseKey), ps)
+}
+
+// handlerSpawn records every spawned unit in the game log and forwards it to
+// the players who can see it. Spawns reusing a unit ID, and when the server
+// is authoritative spawns the player could not afford, are logged as such,
+// discarded and sent back to the player so that they drop the unit. A spawn
+// delivered again is acknowledged without being handled twice. Once a spawn
+// is charged it is acknowledged even if its log can not be written, since a
+// redelivery would observe it again.
+func (r *room) handlerSpawn() func(ctx context.Context, spawn gamelogic.UnitSpawned) pubsub.AckType {
+	return func(ctx context.Context, spawn gamelogic.UnitSpawned) pubsub.AckType {
+		defer fmt.Print("> ")
+		if r.isOffMap(spawn.Username) {
+			return pubsub.NackDiscard
+		}
+
+		messageID := pubsub.MessageIDFromContext(ctx)
+		if r.ledger != nil && r.match.Phase() != routing.MatchFinished {
+			err := r.ledger.Charge(messageID, spawn)
+			if errors.Is(err, gamelogic.ErrDuplicateSpawn) {
+				return pubsub.Ack
+			}
+			if err != nil {
+				r.rejectSpawn(ctx, spawn, err)
+				return pubsub.NackDiscard
+			}
+		}
+
+		event, finished, err := r.match.ObserveSpawn(messageID, spawn)
+		if errors.Is(err, gamelogic.ErrDuplicateSpawn) {
+			return pubsub.Ack
+		}
+		if err != nil {
+			r.rejectSpawn(ctx, spawn, err)
+			return pubsub.NackDiscard
+		}
+		r.announceIfFinished(event, finished)
+		r.forward(ctx, routing.ArmySpawnsVisiblePrefix, r.match.SpawnVisibleTo(spawn), spawn)
+
+		gamelog := routing.GameLog{
+			CurrentTime: time.Now(),
+			Message:     fmt.Sprintf("spawned a(n) %s in %s with id %s", spawn.Unit.Rank, spawn.Unit.Location, spawn.Unit.Ref()),
+			Username:    spawn.Username,
+		}
+		err = r.publishLog(gamelog)
+		if err != nil {
+			fmt.Printf("error publishing log: %v\n", err)
+		}
+		return pubsub.Ack
+	}
+}
+
+// rejectSpawn logs why a spawn was refused and tells the player who spawned
+// it, so that their client does not keep a unit the server never accepted.
+func (r *room) rejectSpawn(ctx context.Context, spawn gamelogic.UnitSpawned, reason error) {
+	fmt.Printf("rejected spawn in %s: %v\n", r.id, reason)
+	gamelog := routing.GameLog{
+		CurrentTime: time.Now(),
+		Message:     fmt.Sprintf("rejected spawn: %v", reason),
+		Username:    spawn.Username,
+	}
+	err := r.publishLog(gamelog)
+	if err != nil {
+		fmt.Printf("error publishing log: %v\n", err)
+	}
+	rejection := gamelogic.SpawnRejection{
+		Username: spawn.Username,
+		Unit:     spawn.Unit,
+		Reason:   reason.Error(),
+	}
+	r.forward(ctx, routing.SpawnRejectedPrefix, []string{spawn.Username}, rejection)
+}
+
+// handlerChat writes chat messages to the game log as the room's transcript.
+// Players sending faster than the transcript limit have the excess dropped.
+// Lines go through the log pipeline like every other game log.
+func (r *room) handlerChat() func(msg routing.ChatMessage) pubsub.AckType {
+	return func(msg routing.ChatMessage) pubsub.AckType {
+		if !r.chatLimiter.Allow(msg.From) {
+			return pubsub.NackDiscard
+		}
+
+		message := fmt.Sprintf("[chat %s] says: %s", r.id, msg.Message)
+		if msg.To != "" {
+			message = fmt.Sprintf("[chat %s] whispers to %s: %s", r.id, msg.To, msg.Message)
+		}
+		gamelog := routing.GameLog{
+			CurrentTime: msg.SentAt,
+			Message:     message,
+			Username:    msg.From,
+		}
+		err := r.publishLog(gamelog)
+		if err != nil {
+			fmt.Printf("error publishing log: %v\n", err)
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
+
+// publishLog hands gamelog to the server's log pipeline, which rate limits,
+// batches and deduplicates it before it is written.
+func (r *room) publishLog(gamelog routing.GameLog) error {
+	channel, err := r.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+	key := r.key(routing.GameLogSlug + "." + gamelog.Username)
+	return pubsub.PublishGob(channel, routing.ExchangePerilTopic, key, gamelog)
+}
+
+// handlerMove keeps the room's view of each player's territories current and
+// forwards the move to the players who can see it, since clients only
+// subscribe to their own visible moves. Moves made on another map are
+// discarded, as are moves made in a room played in rounds, where players
+// give orders instead. Illegal moves are discarded before they are observed,
+// so that the room's view and what players see follow the territory graph.
+func (r *room) handlerMove() func(ctx context.Context, move gamelogic.ArmyMove) pubsub.AckType {
+	return func(ctx context.Context, move gamelogic.ArmyMove) pubsub.AckType {
+		if r.isOffMap(move.Username) {
+			return pubsub.NackDiscard
+		}
+		if r.turnMode {
+			fmt.Printf("discarding move from %s in %s: moves are given as orders\n", move.Username, r.id)
+			return pubsub.NackDiscard
+		}
+		err := gamelogic.ValidateMove(move)
+		if err != nil {
+			fmt.Printf("discarding move from %s in %s: %v\n", move.Username, r.id, err)
+			return pubsub.NackDiscard
+		}
+		event, finished, err := r.match.ObserveMove(move)
+		if err != nil {
+			fmt.Printf("discarding move from %s in %s: %v\n", move.Username, r.id, err)
+			return pubsub.NackDiscard
+		}
+		r.announceIfFinished(event, finished)
+		r.forward(ctx, routing.ArmyMovesVisiblePrefix, r.match.VisibleTo(move), move)
+		return pubsub.Ack
+	}
+}
+
+// forward publishes val to each of usernames under their own key with
+// prefix. Forwarded messages continue the trace of the original. Failures
+// are only reported, since the original has already been observed.
+func (r *room) forward(ctx context.Context, prefix string, usernames []string, val any) {
+	if len(usernames) == 0 {
+		return
+	}
+	channel, err := r.conn.Channel()
+	if err != nil {
+		fmt.Printf("failed to open channel: %v\n", err)
+		return
+	}
+	defer channel.Close()
+	for _, username := range usernames {
+		key := r.key(prefix + "." + username)
+		err = pubsub.PublishJSONContext(ctx, channel, routing.ExchangePerilTopic, key, val)
+		if err != nil {
+			fmt.Printf("failed to forward %s to %s: %v\n", prefix, username, err)
+		}
+	}
+}
+
+// handlerWorldMapRequest answers a client's map request by broadcasting the
+// server's map hash and the room's match phase. A player who loaded a
+// different map is refused until they request again with the server's map;
+// the broadcast tells their client to leave.
+func (r *room) handlerWorldMapRequest() func(req routing.WorldMapRequest) pubsub.AckType {
+	return func(req routing.WorldMapRequest) pubsub.AckType {
+		offMap := req.Hash != gamelogic.GetWorldMap().Hash()
+		if offMap {
+			fmt.Printf("%s joined %s with a different map (%.12s), discarding their moves\n", req.Username, r.id, req.Hash)
+		}
+		r.offMapMu.Lock()
+		r.offMap[req.Username] = offMap
+		r.offMapMu.Unlock()
+
+		err := r.publishWorldMap()
+		if err != nil {
+			fmt.Printf("error publishing world map for %s: %v\n", req.Username, err)
+			return pubsub.NackRequeue
+		}
+		err = r.publishMatchEvent(r.match.Event())
+		if err != nil {
+			fmt.Printf("error publishing match event for %s: %v\n", req.Username, err)
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
+
+// isOffMap reports whether username was refused for playing another map.
+func (r *room) isOffMap(username string) bool {
+	r.offMapMu.Lock()
+	defer r.offMapMu.Unlock()
+	return r.offMap[username]
+}
+
+// publishWorldMap broadcasts the active map's name and hash to the room.
+func (r *room) publishWorldMap() error {
+	channel, err := r.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+	info := gamelogic.GetWorldMap().Info()
+	info.Authoritative = r.ledger != nil
+	return pubsub.PublishJSON(channel, routing.ExchangePerilDirect, r.key(routing.WorldMapKey), info)
+}
+
+// handlerOrder collects the orders given during the open round. Orders for
+// any other round came too late and are discarded.
+func (r *room) handlerOrder() func(order gamelogic.ArmyOrder) pubsub.AckType {
+	return func(order gamelogic.ArmyOrder) pubsub.AckType {
+		if r.isOffMap(order.Username) {
+			return pubsub.NackDiscard
+		}
+		r.ordersMu.Lock()
+		defer r.ordersMu.Unlock()
+		if !r.roundOpen || order.Round != r.round {
+			fmt.Printf("discarding order from %s for round %v in %s: the round is not open\n", order.Username, order.Round, r.id)
+			return pubsub.NackDiscard
+		}
+		r.orders = append(r.orders, order)
+		return pubsub.Ack
+	}
+}
+
+// openRound starts taking orders for round.
+func (r *room) openRound(round int) {
+	r.ordersMu.Lock()
+	defer r.ordersMu.Unlock()
+	r.round = round
+	r.roundOpen = true
+	r.orders = nil
+}
+
+// closeRound stops taking orders and returns those given during the round.
+func (r *room) closeRound() []gamelogic.ArmyOrder {
+	r.ordersMu.Lock()
+	defer r.ordersMu.Unlock()
+	r.roundOpen = false
+	orders := r.orders
+	r.orders = nil
+	return orders
+}
+
+// resolveRound carries out the orders of a round at once and sends each
+// player the resolved moves that concern them: their own first, then those
+// of others they can see.
+func (r *room) resolveRound(channel *amqp.Channel, round int, orders []gamelogic.ArmyOrder) {
+	moves, ev, finished := r.match.ResolveOrders(orders)
+	r.announceIfFinished(ev, finished)
+
+	results := map[string]*gamelogic.RoundResult{}
+	result := func(username string) *gamelogic.RoundResult {
+		res, ok := results[username]
+		if !ok {
+			res = &gamelogic.RoundResult{Round: round}
+			results[username] = res
+		}
+		return res
+	}
+	for _, move := range moves {
+		res := result(move.Username)
+		res.Moves = append(res.Moves, move)
+	}
+	for _, move := range moves {
+		for _, username := range r.match.VisibleTo(move) {
+			res := result(username)
+			res.Moves = append(res.Moves, move)
+		}
+	}
+
+	for username, res := range results {
+		key := r.key(routing.RoundResultPrefix + "." + username)
+		err := pubsub.PublishJSON(channel, routing.ExchangePerilTopic, key, *res)
+		if err != nil {
+			fmt.Printf("failed to send round %v to %s in %s: %v\n", round, username, r.id, err)
+		}
+	}
+}
+
+// runRounds publishes a round start, waits for the round to elapse and then
+// publishes the round end, forever. The orders given during a round are
+// resolved on the server once it ends.
+func (r *room) runRounds(length time.Duration) {
+	channel, err := r.conn.Channel()
+	if err != nil {
+		fmt.Printf("failed to open channel for rounds: %v\n", err)
+		return
+	}
+	defer channel.Close()
+
+	round := 1
+	for {
+		if r.match.Phase() != routing.MatchRunning {
+			if !r.sleep(time.Second) {
+				return
+			}
+			continue
+		}
+
+		start := routing.RoundState{
+			Round:      round,
+			InProgress: true,
+			Deadline:   time.Now().Add(length),
+		}
+		r.openRound(round)
+		err = pubsub.PublishJSON(channel, routing.ExchangePerilDirect, r.key(routing.RoundKey), start)
+		if err != nil {
+			fmt.Printf("failed to publish start of round %v in %s: %v\n", round, r.id, err)
+			return
+		}
+		if !r.sleep(length) {
+			return
+		}
+		orders := r.closeRound()
+
+		end := routing.RoundState{
+			Round:      round,
+			InProgress: false,
+			Deadline:   start.Deadline,
+		}
+		err = pubsub.PublishJSON(channel, routing.ExchangePerilDirect, r.key(routing.RoundKey), end)
+		if err != nil {
+			fmt.Printf("failed to publish end of round %v in %s: %v\n", round, r.id, err)
+			return
+		}
+		r.resolveRound(channel, round, orders)
+		round++
+	}
+}
+
+// runTicks publishes an economy tick on every interval while the match is
+// running, crediting the ledger at the same time when authoritative.
+func (r *room) runTicks(interval time.Duration) {
+	channel, err := r.conn.Channel()
+	if err != nil {
+		fmt.Printf("failed to open channel for ticks: %v\n", err)
+		return
+	}
+	defer channel.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	tick := 1
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+		if r.match.Phase() != routing.MatchRunning {
+			continue
+		}
+		if r.ledger != nil {
+			r.ledger.Tick(r.match.Players())
+		}
+		err = pubsub.PublishJSON(channel, routing.ExchangePerilDirect, r.key(routing.TickKey), routing.EconomyTick{Tick: tick})
+		if err != nil {
+			fmt.Printf("failed to publish tick %v in %s: %v\n", tick, r.id, err)
+			return
+		}
+		tick++
+	}
+}
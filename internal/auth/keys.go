@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadOrCreateKey reads the hex encoded private key seed at path, creating
+// a new key there if the file does not exist. Every server sharing the file
+// issues tokens that the others accept.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid key file %s", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read key file: %v", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate key: %v", err)
+	}
+	err = os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())+"\n"), 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not write key file: %v", err)
+	}
+	return key, nil
+}
+
+// WritePublicKey writes the hex encoded public key of key to path, for
+// clients to verify tokens with.
+func WritePublicKey(path string, key ed25519.PrivateKey) error {
+	pub := key.Public().(ed25519.PublicKey)
+	err := os.WriteFile(path, []byte(hex.EncodeToString(pub)+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write public key file: %v", err)
+	}
+	return nil
+}
+
+// LoadPublicKey reads a public key written by WritePublicKey.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read public key file: %v", err)
+	}
+	pub, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key file %s", path)
+	}
+	return ed25519.PublicKey(pub), nil
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims is what a session token vouches for. A server token vouches for
+// every player, so that the server can forward messages on their behalf.
+// SigningKey is the public key of the session, which must have signed every
+// message published with the token.
+type Claims struct {
+	Username   string
+	Server     bool
+	SigningKey ed25519.PublicKey
+	Expires    time.Time
+}
+
+// Signer issues session tokens signed with the server's private key.
+type Signer struct {
+	key ed25519.PrivateKey
+	ttl time.Duration
+}
+
+// NewSigner returns a signer issuing tokens that are valid for ttl.
+func NewSigner(key ed25519.PrivateKey, ttl time.Duration) *Signer {
+	return &Signer{
+		key: key,
+		ttl: ttl,
+	}
+}
+
+// PublicKey returns the key that verifies the signer's tokens.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Issue returns a token for a session of username signing with signingKey.
+func (s *Signer) Issue(username string, signingKey ed25519.PublicKey) (string, error) {
+	if len(signingKey) != ed25519.PublicKeySize {
+		return "", errors.New("invalid signing key")
+	}
+	return s.sign(Claims{
+		Username:   username,
+		SigningKey: signingKey,
+		Expires:    time.Now().Add(s.ttl),
+	})
+}
+
+// IssueServer returns a token for a session of the server itself.
+func (s *Signer) IssueServer(signingKey ed25519.PublicKey) (string, error) {
+	return s.sign(Claims{
+		Server:     true,
+		SigningKey: signingKey,
+		Expires:    time.Now().Add(s.ttl),
+	})
+}
+
+// sign encodes claims as base64 JSON followed by a dot and the base64
+// signature of the encoded claims.
+func (s *Signer) sign(claims Claims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	sig := ed25519.Sign(s.key, []byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Verifier checks tokens issued by a Signer.
+type Verifier struct {
+	key ed25519.PublicKey
+}
+
+func NewVerifier(key ed25519.PublicKey) (*Verifier, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key")
+	}
+	return &Verifier{
+		key: key,
+	}, nil
+}
+
+// Verify returns the claims of a token with a valid signature that has not
+// expired.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, errors.New("malformed token")
+	}
+	sigBytes, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return Claims{}, errors.New("malformed token signature")
+	}
+	if !ed25519.Verify(v.key, []byte(payload), sigBytes) {
+		return Claims{}, errors.New("bad token signature")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Claims{}, errors.New("malformed token claims")
+	}
+	var claims Claims
+	err = json.Unmarshal(data, &claims)
+	if err != nil {
+		return Claims{}, errors.New("malformed token claims")
+	}
+	if time.Now().After(claims.Expires) {
+		return Claims{}, errors.New("token has expired")
+	}
+	if len(claims.SigningKey) != ed25519.PublicKeySize {
+		return Claims{}, errors.New("token has no signing key")
+	}
+	return claims, nil
+}
+
+// CheckMessage verifies token, that it was issued to claimed or to the
+// server, and that sig is the session's signature of data. An empty claimed
+// accepts a token issued to anyone, unless serverOnly requires a server's
+// token.
+func (v *Verifier) CheckMessage(token, claimed string, serverOnly bool, data, sig []byte) error {
+	if token == "" {
+		return errors.New("missing session token")
+	}
+	claims, err := v.Verify(token)
+	if err != nil {
+		return err
+	}
+	if serverOnly && !claims.Server {
+		return fmt.Errorf("only a server may publish this message, not %s", claims.Username)
+	}
+	if claimed != "" && !claims.Server && claims.Username != claimed {
+		return fmt.Errorf("token was issued to %s", claims.Username)
+	}
+	if !ed25519.Verify(claims.SigningKey, data, sig) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+// session returns a token from issue and the key that signs with it.
+func session(t *testing.T, issue func(ed25519.PublicKey) (string, error)) (string, ed25519.PrivateKey) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := issue(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, key
+}
+
+func TestCheckMessage(t *testing.T) {
+	_, serverKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewSigner(serverKey, time.Hour)
+	verifier, err := NewVerifier(signer.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliceToken, aliceKey := session(t, func(pub ed25519.PublicKey) (string, error) {
+		return signer.Issue("alice", pub)
+	})
+	serverToken, serverSession := session(t, signer.IssueServer)
+	data := []byte("main.pause\nid\n{}")
+
+	cases := []struct {
+		name       string
+		token      string
+		key        ed25519.PrivateKey
+		claimed    string
+		serverOnly bool
+		ok         bool
+	}{
+		{"player as themselves", aliceToken, aliceKey, "alice", false, true},
+		{"player as someone else", aliceToken, aliceKey, "bob", false, false},
+		{"player without a claim", aliceToken, aliceKey, "", false, true},
+		{"player sending a server message", aliceToken, aliceKey, "", true, false},
+		{"server sending a server message", serverToken, serverSession, "", true, true},
+		{"server on a player's behalf", serverToken, serverSession, "alice", false, true},
+		{"token signed by another key", aliceToken, serverSession, "alice", false, false},
+	}
+	for _, c := range cases {
+		err := verifier.CheckMessage(c.token, c.claimed, c.serverOnly, data, ed25519.Sign(c.key, data))
+		if (err == nil) != c.ok {
+			t.Errorf("%s: CheckMessage() = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Players may send chatBurst messages at once and chatBurst messages per
+// chatPeriod on average.
+const (
+	chatBurst  = 5
+	chatPeriod = 10 * time.Second
+)
+
+// CommandSay builds a chat message for every player in the room.
+func (gs *GameState) CommandSay(words []string) (routing.ChatMessage, error) {
+	if len(words) < 2 {
+		return routing.ChatMessage{}, errors.New("usage: say <message>")
+	}
+	return gs.newChatMessage("", strings.Join(words[1:], " "))
+}
+
+// CommandWhisper builds a chat message for a single player.
+func (gs *GameState) CommandWhisper(words []string) (routing.ChatMessage, error) {
+	if len(words) < 3 {
+		return routing.ChatMessage{}, errors.New("usage: whisper <player> <message>")
+	}
+	if words[1] == gs.GetUsername() {
+		return routing.ChatMessage{}, errors.New("error: you can not whisper to yourself")
+	}
+	return gs.newChatMessage(words[1], strings.Join(words[2:], " "))
+}
+
+func (gs *GameState) newChatMessage(to, message string) (routing.ChatMessage, error) {
+	if !gs.chatLimiter.Allow() {
+		return routing.ChatMessage{}, errors.New("error: you are sending messages too quickly, slow down")
+	}
+	return routing.ChatMessage{
+		From:    gs.GetUsername(),
+		To:      to,
+		Message: message,
+		SentAt:  time.Now(),
+	}, nil
+}
+
+// HandleChat prints a chat message received from another player.
+func (gs *GameState) HandleChat(msg routing.ChatMessage) {
+	if msg.From == gs.GetUsername() {
+		return
+	}
+	fmt.Println()
+	if msg.To == "" {
+		fmt.Printf("[%s] %s: %s\n", msg.SentAt.Format("15:04:05"), msg.From, msg.Message)
+		return
+	}
+	fmt.Printf("[%s] %s whispers: %s\n", msg.SentAt.Format("15:04:05"), msg.From, msg.Message)
+}
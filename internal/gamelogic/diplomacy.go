@@ -0,0 +1,177 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type DiplomacyAction string
+
+const (
+	DiplomacyAlly  DiplomacyAction = "ally"
+	DiplomacyPeace DiplomacyAction = "peace"
+	DiplomacyBreak DiplomacyAction = "break"
+)
+
+// DiplomacyMessage is sent from one player to another. An ally or peace
+// offer takes effect once both players have made the same offer to each
+// other; a break ends any treaty immediately.
+type DiplomacyMessage struct {
+	From   string
+	To     string
+	Action DiplomacyAction
+}
+
+// ClaimedUsername returns the player the message claims to come from.
+func (dm DiplomacyMessage) ClaimedUsername() string {
+	return dm.From
+}
+
+// CommandAlly offers an alliance to a player, or accepts their offer.
+func (gs *GameState) CommandAlly(words []string) (DiplomacyMessage, error) {
+	if len(words) < 2 {
+		return DiplomacyMessage{}, errors.New("usage: ally <player>")
+	}
+	return gs.offerTreaty(words[1], DiplomacyAlly)
+}
+
+// CommandOfferPeace offers peace to a player, or accepts their offer.
+func (gs *GameState) CommandOfferPeace(words []string) (DiplomacyMessage, error) {
+	if len(words) < 3 || words[1] != "peace" {
+		return DiplomacyMessage{}, errors.New("usage: offer peace <player>")
+	}
+	return gs.offerTreaty(words[2], DiplomacyPeace)
+}
+
+// CommandBreak ends any treaty or pending offer with a player.
+func (gs *GameState) CommandBreak(words []string) (DiplomacyMessage, error) {
+	if len(words) < 2 {
+		return DiplomacyMessage{}, errors.New("usage: break <player>")
+	}
+	other := words[1]
+	if other == gs.GetUsername() {
+		return DiplomacyMessage{}, errors.New("error: you can not break a treaty with yourself")
+	}
+
+	gs.mu.Lock()
+	relation, ok := gs.Relations[other]
+	if ok {
+		gs.record(Event{Kind: EventRelationChanged, Other: other})
+	}
+	delete(gs.outgoingOffers, other)
+	delete(gs.incomingOffers, other)
+	gs.mu.Unlock()
+	gs.persist()
+
+	if ok {
+		fmt.Printf("You broke your %s treaty with %s.\n", relation, other)
+	} else {
+		fmt.Printf("You withdrew any offers to %s.\n", other)
+	}
+	return DiplomacyMessage{
+		From:   gs.GetUsername(),
+		To:     other,
+		Action: DiplomacyBreak,
+	}, nil
+}
+
+// offerTreaty records an offer to other, concluding the treaty if they have
+// already made the same offer.
+func (gs *GameState) offerTreaty(other string, action DiplomacyAction) (DiplomacyMessage, error) {
+	if other == gs.GetUsername() {
+		return DiplomacyMessage{}, fmt.Errorf("error: you can not make a(n) %s offer to yourself", action)
+	}
+
+	gs.mu.Lock()
+	if gs.Relations[other] == action {
+		gs.mu.Unlock()
+		return DiplomacyMessage{}, fmt.Errorf("error: you already have a(n) %s treaty with %s", action, other)
+	}
+	concluded := gs.incomingOffers[other] == action
+	if concluded {
+		gs.record(Event{Kind: EventRelationChanged, Other: other, Relation: action})
+		delete(gs.incomingOffers, other)
+		delete(gs.outgoingOffers, other)
+	} else {
+		gs.outgoingOffers[other] = action
+	}
+	gs.mu.Unlock()
+	gs.persist()
+
+	if concluded {
+		fmt.Printf("You accepted %s's %s offer.\n", other, action)
+	} else {
+		fmt.Printf("You offered %s to %s.\n", action, other)
+	}
+	return DiplomacyMessage{
+		From:   gs.GetUsername(),
+		To:     other,
+		Action: action,
+	}, nil
+}
+
+// HandleDiplomacy applies a diplomacy message sent to the local player.
+func (gs *GameState) HandleDiplomacy(dm DiplomacyMessage) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Diplomacy ====")
+
+	defer gs.persist()
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if dm.Action == DiplomacyBreak {
+		relation, ok := gs.Relations[dm.From]
+		if ok {
+			gs.record(Event{Kind: EventRelationChanged, Other: dm.From})
+		}
+		delete(gs.outgoingOffers, dm.From)
+		delete(gs.incomingOffers, dm.From)
+		if ok {
+			fmt.Printf("%s broke your %s treaty!\n", dm.From, relation)
+		} else {
+			fmt.Printf("%s withdrew their offers.\n", dm.From)
+		}
+		return
+	}
+
+	if gs.outgoingOffers[dm.From] == dm.Action {
+		gs.record(Event{Kind: EventRelationChanged, Other: dm.From, Relation: dm.Action})
+		delete(gs.outgoingOffers, dm.From)
+		delete(gs.incomingOffers, dm.From)
+		fmt.Printf("%s accepted your %s offer.\n", dm.From, dm.Action)
+		return
+	}
+
+	gs.incomingOffers[dm.From] = dm.Action
+	switch dm.Action {
+	case DiplomacyAlly:
+		fmt.Printf("%s offers an alliance. Type 'ally %s' to accept.\n", dm.From, dm.From)
+	case DiplomacyPeace:
+		fmt.Printf("%s offers peace. Type 'offer peace %s' to accept.\n", dm.From, dm.From)
+	}
+}
+
+// hasTreaty reports whether the local player is allied or at peace with
+// username.
+func (gs *GameState) hasTreaty(username string) (DiplomacyAction, bool) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	relation, ok := gs.Relations[username]
+	return relation, ok
+}
+
+// printRelations prints every treaty the local player has, ordered by name.
+func (gs *GameState) printRelations() {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	names := []string{}
+	for name := range gs.Relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("* %s with %s\n", gs.Relations[name], name)
+	}
+}
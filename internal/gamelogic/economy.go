@@ -0,0 +1,143 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// getRankCost returns the resources needed to spawn a unit of each rank.
+func getRankCost() map[UnitRank]int {
+	cost := map[UnitRank]int{}
+	for _, r := range GetWorldMap().Ranks {
+		cost[r.Rank] = r.Cost
+	}
+	return cost
+}
+
+// getTerritoryIncome returns the resources each territory yields per tick.
+func getTerritoryIncome() map[Location]int {
+	income := map[Location]int{}
+	for _, t := range GetWorldMap().Territories {
+		income[t.Name] = t.Income
+	}
+	return income
+}
+
+// incomeFor returns the resources earned per tick by a player, counting each
+// territory they hold at least one unit in once.
+func incomeFor(p Player) int {
+	territoryIncome := getTerritoryIncome()
+	held := map[Location]struct{}{}
+	for _, unit := range p.Units {
+		held[unit.Location] = struct{}{}
+	}
+	income := 0
+	for loc := range held {
+		income += territoryIncome[loc]
+	}
+	return income
+}
+
+func (gs *GameState) GetResources() int {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.Resources
+}
+
+// spendResources deducts cost from the player's resources, failing if they
+// can not afford it.
+func (gs *GameState) spendResources(cost int) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.Resources < cost {
+		return fmt.Errorf("error: you need %v resources but only have %v", cost, gs.Resources)
+	}
+	gs.record(Event{Kind: EventResourcesChanged, Amount: -cost})
+	return nil
+}
+
+// HandleTick credits the player with the income of every territory they hold.
+func (gs *GameState) HandleTick(tick routing.EconomyTick) {
+	if gs.isPaused() {
+		return
+	}
+	income := incomeFor(gs.GetPlayerSnap())
+	if income == 0 {
+		return
+	}
+
+	defer gs.persist()
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.record(Event{Kind: EventResourcesChanged, Amount: income})
+}
+
+// Ledger is the server's authoritative record of every player's resources.
+type Ledger struct {
+	balances map[string]int
+	// charged holds the units already paid for and the messages that
+	// spawned them, so that a redelivered spawn is not charged twice.
+	charged spawnLog
+	mu      *sync.Mutex
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{
+		balances: map[string]int{},
+		charged:  spawnLog{},
+		mu:       &sync.Mutex{},
+	}
+}
+
+// balance returns a player's balance, opening their account with the map's
+// starting resources when they are seen for the first time.
+func (l *Ledger) balance(username string) int {
+	if _, ok := l.balances[username]; !ok {
+		l.balances[username] = GetWorldMap().StartingResources
+	}
+	return l.balances[username]
+}
+
+// Tick credits every player with the income of the territories they hold.
+func (l *Ledger) Tick(players []Player) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range players {
+		l.balances[p.Username] = l.balance(p.Username) + incomeFor(p)
+	}
+}
+
+// Charge deducts the cost of a spawned unit from its owner's balance and
+// returns an error if they could not afford it or had already spawned a unit
+// with the same ID. A spawn delivered again under the same message ID is not
+// charged twice; ErrDuplicateSpawn is returned instead.
+func (l *Ledger) Charge(messageID string, spawn UnitSpawned) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.charged.check(messageID, spawn)
+	if err != nil {
+		return err
+	}
+
+	cost, ok := getRankCost()[spawn.Unit.Rank]
+	if !ok {
+		return fmt.Errorf("%s is not a valid unit", spawn.Unit.Rank)
+	}
+	balance := l.balance(spawn.Username)
+	if balance < cost {
+		return fmt.Errorf("%s spawned a(n) %s costing %v with only %v resources", spawn.Username, spawn.Unit.Rank, cost, balance)
+	}
+	l.balances[spawn.Username] = balance - cost
+	l.charged.add(messageID, spawn)
+	return nil
+}
+
+// Balance returns the resources the ledger believes a player has.
+func (l *Ledger) Balance(username string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.balance(username)
+}
@@ -0,0 +1,124 @@
+package gamelogic
+
+import (
+	"testing"
+)
+
+func TestLedgerCharge(t *testing.T) {
+	start := GetWorldMap().StartingResources
+	cost := getRankCost()
+	type charge struct {
+		messageID string
+		spawn     UnitSpawned
+		wantErr   error
+	}
+	spawn := func(owner string, id int, rank UnitRank) UnitSpawned {
+		return UnitSpawned{Username: owner, Unit: unit(owner, id, rank, "europe")}
+	}
+	cases := []struct {
+		name        string
+		charges     []charge
+		wantBalance int
+	}{
+		{
+			name: "units are charged their cost",
+			charges: []charge{
+				{"m1", spawn("alice", 1, RankInfantry), nil},
+				{"m2", spawn("alice", 2, RankCavalry), nil},
+			},
+			wantBalance: start - cost[RankInfantry] - cost[RankCavalry],
+		},
+		{
+			name: "a redelivered spawn is charged once",
+			charges: []charge{
+				{"m1", spawn("alice", 1, RankCavalry), nil},
+				{"m1", spawn("alice", 1, RankCavalry), ErrDuplicateSpawn},
+			},
+			wantBalance: start - cost[RankCavalry],
+		},
+		{
+			name: "a reused unit ID is rejected",
+			charges: []charge{
+				{"m1", spawn("alice", 1, RankInfantry), nil},
+				{"m2", spawn("alice", 1, RankArtillery), errAny},
+			},
+			wantBalance: start - cost[RankInfantry],
+		},
+		{
+			name: "a spawn without a message ID is never a redelivery",
+			charges: []charge{
+				{"", spawn("alice", 1, RankInfantry), nil},
+				{"", spawn("alice", 1, RankInfantry), errAny},
+			},
+			wantBalance: start - cost[RankInfantry],
+		},
+		{
+			name: "other players' unit IDs do not count",
+			charges: []charge{
+				{"m1", spawn("bob", 1, RankArtillery), nil},
+				{"m2", spawn("alice", 1, RankInfantry), nil},
+			},
+			wantBalance: start - cost[RankInfantry],
+		},
+		{
+			name: "a unit of another player is rejected",
+			charges: []charge{
+				{"m1", UnitSpawned{Username: "alice", Unit: unit("bob", 1, RankInfantry, "europe")}, errAny},
+			},
+			wantBalance: start,
+		},
+		{
+			name: "an unaffordable unit is rejected",
+			charges: []charge{
+				{"m1", spawn("alice", 1, RankArtillery), nil},
+				{"m2", spawn("alice", 2, RankArtillery), errAny},
+				{"m3", spawn("alice", 2, RankInfantry), nil},
+			},
+			wantBalance: start - cost[RankArtillery] - cost[RankInfantry],
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := NewLedger()
+			for _, ch := range c.charges {
+				checkErr(t, l.Charge(ch.messageID, ch.spawn), ch.wantErr)
+			}
+			if got := l.Balance("alice"); got != c.wantBalance {
+				t.Errorf("balance = %v, want %v", got, c.wantBalance)
+			}
+		})
+	}
+}
+
+func TestHandleSpawnRejectionRefunds(t *testing.T) {
+	cases := []struct {
+		name          string
+		rejected      Unit
+		wantUnits     int
+		wantResources int
+	}{
+		{"rejected unit", unit("alice", 1, RankCavalry, "europe"), 0, GetWorldMap().StartingResources},
+		{"unknown unit", unit("alice", 2, RankCavalry, "europe"), 1, GetWorldMap().StartingResources - getRankCost()[RankCavalry]},
+		{"unit of another rank", unit("alice", 1, RankInfantry, "europe"), 1, GetWorldMap().StartingResources - getRankCost()[RankCavalry]},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gs, err := NewGameState("alice", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = gs.CommandSpawn([]string{"spawn", "europe", string(RankCavalry)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			gs.HandleSpawnRejection(SpawnRejection{Username: "alice", Unit: c.rejected, Reason: "test"})
+			snapshot := gs.Snapshot()
+			if len(snapshot.Player.Units) != c.wantUnits {
+				t.Errorf("player has %v units, want %v", len(snapshot.Player.Units), c.wantUnits)
+			}
+			if snapshot.Resources != c.wantResources {
+				t.Errorf("resources = %v, want %v", snapshot.Resources, c.wantResources)
+			}
+		})
+	}
+}
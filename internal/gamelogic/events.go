@@ -0,0 +1,117 @@
+package gamelogic
+
+import (
+	"time"
+)
+
+type EventKind string
+
+const (
+	EventUnitSpawned      EventKind = "unit_spawned"
+	EventUnitMoved        EventKind = "unit_moved"
+	EventUnitsDestroyed   EventKind = "units_destroyed"
+	EventUnitRejected     EventKind = "unit_rejected"
+	EventResourcesChanged EventKind = "resources_changed"
+	EventRelationChanged  EventKind = "relation_changed"
+)
+
+// Event is a single change to a player's state. The state is the result of
+// folding every event in Seq order, starting from NewSnapshot.
+type Event struct {
+	Seq      int
+	At       time.Time
+	Username string
+	Kind     EventKind
+	// Unit is the unit spawned or moved, in its new location, or the unit
+	// whose spawn the server rejected.
+	Unit Unit
+	// Location is where units were destroyed.
+	Location Location
+	// Amount is the change in resources.
+	Amount int
+	// Other is the opponent who destroyed the units, or the player a
+	// relation is with.
+	Other string
+	// Relation is the new treaty with Other. It is empty when the treaty
+	// was broken.
+	Relation DiplomacyAction
+}
+
+// NewSnapshot returns the state of a player who has not played yet.
+func NewSnapshot(username string) GameSnapshot {
+	return GameSnapshot{
+		Player: Player{
+			Username: username,
+			Units:    map[int]Unit{},
+		},
+		Resources: GetWorldMap().StartingResources,
+		Relations: map[string]DiplomacyAction{},
+	}
+}
+
+// Apply folds ev into the snapshot.
+func (s *GameSnapshot) Apply(ev Event) {
+	if s.Player.Units == nil {
+		s.Player.Units = map[int]Unit{}
+	}
+	if s.Relations == nil {
+		s.Relations = map[string]DiplomacyAction{}
+	}
+
+	switch ev.Kind {
+	case EventUnitSpawned:
+		s.Player.Units[ev.Unit.ID] = ev.Unit
+		if ev.Unit.ID > s.LastUnitID {
+			s.LastUnitID = ev.Unit.ID
+		}
+	case EventUnitMoved:
+		s.Player.Units[ev.Unit.ID] = ev.Unit
+	case EventUnitsDestroyed:
+		removeUnitsInLocation(s.Player, ev.Location)
+	case EventUnitRejected:
+		delete(s.Player.Units, ev.Unit.ID)
+	case EventResourcesChanged:
+		s.Resources += ev.Amount
+	case EventRelationChanged:
+		if ev.Relation == "" {
+			delete(s.Relations, ev.Other)
+		} else {
+			s.Relations[ev.Other] = ev.Relation
+		}
+	}
+	s.Seq = ev.Seq
+}
+
+// Fold applies events to snapshot in order, skipping any the snapshot
+// already includes.
+func Fold(snapshot GameSnapshot, events []Event) GameSnapshot {
+	for _, ev := range events {
+		if ev.Seq <= snapshot.Seq {
+			continue
+		}
+		snapshot.Apply(ev)
+	}
+	return snapshot
+}
+
+// record applies ev to the state and queues it to be appended to the event
+// log by the next persist. The caller must hold gs.mu.
+func (gs *GameState) record(ev Event) {
+	gs.lastSeq++
+	ev.Seq = gs.lastSeq
+	ev.At = time.Now()
+	ev.Username = gs.Player.Username
+
+	// The snapshot shares the state's maps, so only the scalar fields need
+	// to be copied back.
+	s := GameSnapshot{
+		Player:     gs.Player,
+		LastUnitID: gs.LastUnitID,
+		Resources:  gs.Resources,
+		Relations:  gs.Relations,
+	}
+	s.Apply(ev)
+	gs.LastUnitID = s.LastUnitID
+	gs.Resources = s.Resources
+	gs.unsaved = append(gs.unsaved, ev)
+}
@@ -0,0 +1,241 @@
+package gamelogic
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// memoryStore keeps the snapshots and event logs of players in memory.
+type memoryStore struct {
+	snapshots map[string]GameSnapshot
+	events    map[string][]Event
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		snapshots: map[string]GameSnapshot{},
+		events:    map[string][]Event{},
+	}
+}
+
+func (s *memoryStore) Load(username string) (GameSnapshot, bool, error) {
+	snapshot, ok := s.snapshots[username]
+	return snapshot, ok, nil
+}
+
+func (s *memoryStore) Save(snapshot GameSnapshot) error {
+	s.snapshots[snapshot.Player.Username] = snapshot
+	return nil
+}
+
+func (s *memoryStore) Append(events []Event) error {
+	for _, ev := range events {
+		s.events[ev.Username] = append(s.events[ev.Username], ev)
+	}
+	return nil
+}
+
+func (s *memoryStore) Events(username string, after int) ([]Event, error) {
+	events := []Event{}
+	for _, ev := range s.events[username] {
+		if ev.Seq > after {
+			events = append(events, ev)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func unit(owner string, id int, rank UnitRank, loc Location) Unit {
+	return Unit{ID: id, Owner: owner, Rank: rank, Location: loc}
+}
+
+// unitIDs returns the IDs of a player's units, in order.
+func unitIDs(p Player) []int {
+	ids := []int{}
+	for id := range p.Units {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestFold(t *testing.T) {
+	start := GetWorldMap().StartingResources
+	cases := []struct {
+		name          string
+		snapshot      GameSnapshot
+		events        []Event
+		wantUnits     map[int]Unit
+		wantLastID    int
+		wantResources int
+		wantRelations map[string]DiplomacyAction
+		wantSeq       int
+	}{
+		{
+			name:          "no events",
+			snapshot:      NewSnapshot("alice"),
+			wantUnits:     map[int]Unit{},
+			wantResources: start,
+			wantRelations: map[string]DiplomacyAction{},
+		},
+		{
+			name:     "spawn and move",
+			snapshot: NewSnapshot("alice"),
+			events: []Event{
+				{Seq: 1, Kind: EventResourcesChanged, Amount: -1},
+				{Seq: 2, Kind: EventUnitSpawned, Unit: unit("alice", 1, RankInfantry, "europe")},
+				{Seq: 3, Kind: EventUnitMoved, Unit: unit("alice", 1, RankInfantry, "asia")},
+			},
+			wantUnits:     map[int]Unit{1: unit("alice", 1, RankInfantry, "asia")},
+			wantLastID:    1,
+			wantResources: start - 1,
+			wantRelations: map[string]DiplomacyAction{},
+			wantSeq:       3,
+		},
+		{
+			name:     "battle lost",
+			snapshot: NewSnapshot("alice"),
+			events: []Event{
+				{Seq: 1, Kind: EventUnitSpawned, Unit: unit("alice", 1, RankInfantry, "europe")},
+				{Seq: 2, Kind: EventUnitSpawned, Unit: unit("alice", 2, RankCavalry, "europe")},
+				{Seq: 3, Kind: EventUnitSpawned, Unit: unit("alice", 3, RankInfantry, "asia")},
+				{Seq: 4, Kind: EventUnitsDestroyed, Location: "europe", Other: "bob"},
+			},
+			wantUnits:     map[int]Unit{3: unit("alice", 3, RankInfantry, "asia")},
+			wantLastID:    3,
+			wantResources: start,
+			wantRelations: map[string]DiplomacyAction{},
+			wantSeq:       4,
+		},
+		{
+			name:     "rejected spawn is refunded",
+			snapshot: NewSnapshot("alice"),
+			events: []Event{
+				{Seq: 1, Kind: EventResourcesChanged, Amount: -6},
+				{Seq: 2, Kind: EventUnitSpawned, Unit: unit("alice", 1, RankCavalry, "europe")},
+				{Seq: 3, Kind: EventUnitRejected, Unit: unit("alice", 1, RankCavalry, "europe")},
+				{Seq: 4, Kind: EventResourcesChanged, Amount: 6},
+			},
+			wantUnits:     map[int]Unit{},
+			wantLastID:    1,
+			wantResources: start,
+			wantRelations: map[string]DiplomacyAction{},
+			wantSeq:       4,
+		},
+		{
+			name:     "treaty concluded and broken",
+			snapshot: NewSnapshot("alice"),
+			events: []Event{
+				{Seq: 1, Kind: EventRelationChanged, Other: "bob", Relation: DiplomacyAlly},
+				{Seq: 2, Kind: EventRelationChanged, Other: "carol", Relation: DiplomacyPeace},
+				{Seq: 3, Kind: EventRelationChanged, Other: "bob"},
+			},
+			wantUnits:     map[int]Unit{},
+			wantResources: start,
+			wantRelations: map[string]DiplomacyAction{"carol": DiplomacyPeace},
+			wantSeq:       3,
+		},
+		{
+			name: "events in the snapshot are skipped",
+			snapshot: GameSnapshot{
+				Player:     Player{Username: "alice", Units: map[int]Unit{1: unit("alice", 1, RankInfantry, "asia")}},
+				LastUnitID: 1,
+				Resources:  5,
+				Seq:        2,
+			},
+			events: []Event{
+				{Seq: 1, Kind: EventResourcesChanged, Amount: -1},
+				{Seq: 2, Kind: EventUnitSpawned, Unit: unit("alice", 1, RankInfantry, "europe")},
+				{Seq: 3, Kind: EventResourcesChanged, Amount: 3},
+			},
+			wantUnits:     map[int]Unit{1: unit("alice", 1, RankInfantry, "asia")},
+			wantLastID:    1,
+			wantResources: 8,
+			wantRelations: map[string]DiplomacyAction{},
+			wantSeq:       3,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := Fold(c.snapshot, c.events)
+			if !reflect.DeepEqual(got.Player.Units, c.wantUnits) {
+				t.Errorf("units = %v, want %v", got.Player.Units, c.wantUnits)
+			}
+			if got.LastUnitID != c.wantLastID {
+				t.Errorf("LastUnitID = %v, want %v", got.LastUnitID, c.wantLastID)
+			}
+			if got.Resources != c.wantResources {
+				t.Errorf("resources = %v, want %v", got.Resources, c.wantResources)
+			}
+			if !reflect.DeepEqual(got.Relations, c.wantRelations) {
+				t.Errorf("relations = %v, want %v", got.Relations, c.wantRelations)
+			}
+			if got.Seq != c.wantSeq {
+				t.Errorf("seq = %v, want %v", got.Seq, c.wantSeq)
+			}
+		})
+	}
+}
+
+func TestGameStateRestoresFromSnapshot(t *testing.T) {
+	cases := []struct {
+		name         string
+		spawns       int
+		wantSnapshot int
+	}{
+		{"events only", 3, 0},
+		{"one snapshot", 10, snapshotEvery},
+		{"snapshot and later events", 13, snapshotEvery},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := newMemoryStore()
+			gs, err := NewGameState("alice", store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Every spawn records two events: its cost and the unit.
+			for i := 0; i < c.spawns; i++ {
+				_, err := gs.CommandSpawn([]string{"spawn", "europe", string(RankInfantry)})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			snapshot, ok := store.snapshots["alice"]
+			if c.wantSnapshot == 0 && ok {
+				t.Fatalf("snapshot saved at seq %v, want none", snapshot.Seq)
+			}
+			if c.wantSnapshot > 0 && snapshot.Seq != c.wantSnapshot {
+				t.Fatalf("snapshot saved at seq %v, want %v", snapshot.Seq, c.wantSnapshot)
+			}
+
+			restored, err := NewGameState("alice", store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, got := gs.Snapshot(), restored.Snapshot()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("restored %+v, want %+v", got, want)
+			}
+			if len(unitIDs(got.Player)) != c.spawns {
+				t.Errorf("restored %v units, want %v", len(got.Player.Units), c.spawns)
+			}
+
+			// The restored state carries on numbering units where it
+			// left off.
+			spawn, err := restored.CommandSpawn([]string{"spawn", "asia", string(RankInfantry)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spawn.Unit.ID != c.spawns+1 {
+				t.Errorf("next unit has ID %v, want %v", spawn.Unit.ID, c.spawns+1)
+			}
+		})
+	}
+}
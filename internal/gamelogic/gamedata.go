@@ -1,5 +1,10 @@
 package gamelogic
 
+import (
+	"errors"
+	"fmt"
+)
+
 type Player struct {
 	Username string
 	Units    map[int]Unit
@@ -15,38 +20,133 @@ const (
 
 type Unit struct {
 	ID       int
+	Owner    string
 	Rank     UnitRank
 	Location Location
 }
 
+// UnitRef identifies a unit across players. Unit IDs are only unique per
+// player, so a reference carries the owner's username as well.
+type UnitRef struct {
+	Owner string
+	ID    int
+}
+
+func (r UnitRef) String() string {
+	return fmt.Sprintf("%s#%d", r.Owner, r.ID)
+}
+
+// Ref returns the globally unique reference for the unit.
+func (u Unit) Ref() UnitRef {
+	return UnitRef{Owner: u.Owner, ID: u.ID}
+}
+
+// ArmyMove carries only the units that moved, never the rest of the
+// player's army.
 type ArmyMove struct {
-	Player     Player
+	Username   string
 	Units      []Unit
 	ToLocation Location
+	// Origins maps each moved unit's ID to the location it moved from.
+	Origins map[int]Location
+}
+
+type UnitSpawned struct {
+	Username string
+	Unit     Unit
+}
+
+// ClaimedUsername returns the player the move claims to come from.
+func (m ArmyMove) ClaimedUsername() string {
+	return m.Username
+}
+
+// Sender returns the moving player holding only the units in the move.
+func (m ArmyMove) Sender() Player {
+	units := map[int]Unit{}
+	for _, unit := range m.Units {
+		units[unit.ID] = unit
+	}
+	return Player{Username: m.Username, Units: units}
+}
+
+// Sender returns the spawning player holding only the new unit.
+func (s UnitSpawned) Sender() Player {
+	return Player{Username: s.Username, Units: map[int]Unit{s.Unit.ID: s.Unit}}
 }
 
+// ClaimedUsername returns the player the spawn claims to come from.
+func (s UnitSpawned) ClaimedUsername() string {
+	return s.Username
+}
+
+// ErrDuplicateSpawn is returned for a spawn whose message was already
+// handled and has been delivered again.
+var ErrDuplicateSpawn = errors.New("spawn already handled")
+
+// spawnLog maps every unit spawned to the ID of the message that spawned
+// it. Unit IDs are chosen by the player, so a spawn is told apart from its
+// redeliveries by its message ID, and a unit ID is only ever spawned once.
+type spawnLog map[UnitRef]string
+
+// check returns ErrDuplicateSpawn if the spawn's message was already
+// handled, or an error if the spawn reuses a unit ID or gives the player a
+// unit owned by someone else.
+func (l spawnLog) check(messageID string, spawn UnitSpawned) error {
+	if spawn.Unit.Owner != spawn.Username {
+		return fmt.Errorf("%s spawned a unit owned by %s", spawn.Username, spawn.Unit.Owner)
+	}
+	id, ok := l[spawn.Unit.Ref()]
+	if !ok {
+		return nil
+	}
+	if messageID != "" && id == messageID {
+		return ErrDuplicateSpawn
+	}
+	return fmt.Errorf("%s already spawned unit %v", spawn.Username, spawn.Unit.ID)
+}
+
+// add records the spawn once it has been checked.
+func (l spawnLog) add(messageID string, spawn UnitSpawned) {
+	l[spawn.Unit.Ref()] = messageID
+}
+
+// SpawnRejection tells a player that the server refused one of their
+// spawns, so that they drop the unit and get its cost back.
+type SpawnRejection struct {
+	Username string
+	Unit     Unit
+	Reason   string
+}
+
+// Only the server rejects spawns.
+func (SpawnRejection) ServerOnly() {}
+
 type RecognitionOfWar struct {
 	Attacker Player
 	Defender Player
 }
 
+// ClaimedUsername returns the defender, who is the one that publishes a
+// recognition of war.
+func (rw RecognitionOfWar) ClaimedUsername() string {
+	return rw.Defender.Username
+}
+
 type Location string
 
 func getAllRanks() map[UnitRank]struct{} {
-	return map[UnitRank]struct{}{
-		RankInfantry:  {},
-		RankCavalry:   {},
-		RankArtillery: {},
+	ranks := map[UnitRank]struct{}{}
+	for _, r := range GetWorldMap().Ranks {
+		ranks[r.Rank] = struct{}{}
 	}
+	return ranks
 }
 
 func getAllLocations() map[Location]struct{} {
-	return map[Location]struct{}{
-		"americas":   {},
-		"europe":     {},
-		"africa":     {},
-		"asia":       {},
-		"australia":  {},
-		"antarctica": {},
+	locations := map[Location]struct{}{}
+	for _, t := range GetWorldMap().Territories {
+		locations[t.Name] = struct{}{}
 	}
+	return locations
 }
@@ -18,6 +18,16 @@ func PrintClientHelp() {
 	fmt.Println("    example:")
 	fmt.Println("    spawn europe infantry")
 	fmt.Println("* status")
+	fmt.Println("* ally <player>")
+	fmt.Println("* offer peace <player>")
+	fmt.Println("* break <player>")
+	fmt.Println("* say <message>")
+	fmt.Println("* whisper <player> <message>")
+	fmt.Println("    example:")
+	fmt.Println("    whisper bob meet me in asia")
+	fmt.Println("* join <room>")
+	fmt.Println("    example:")
+	fmt.Println("    join friends")
 	fmt.Println("* spam <n>")
 	fmt.Println("    example:")
 	fmt.Println("    spam 5")
@@ -38,10 +48,38 @@ func ClientWelcome() (string, error) {
 	return username, nil
 }
 
+// GetPassword asks for the password of the player's broker user, which
+// they log in with. Broker users are created with `rabbit.sh adduser`.
+func GetPassword() (string, error) {
+	fmt.Println("Please enter your broker password:")
+	fmt.Print("> ")
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return "", errors.New("you must enter a password. goodbye")
+	}
+	password := strings.TrimSpace(scanner.Text())
+	if password == "" {
+		return "", errors.New("you must enter a password. goodbye")
+	}
+	return password, nil
+}
+
 func PrintServerHelp() {
 	fmt.Println("Possible commands:")
-	fmt.Println("* pause")
-	fmt.Println("* resume")
+	fmt.Println("* create <room>")
+	fmt.Println("* rooms")
+	fmt.Println("* start [room]")
+	fmt.Println("* pause [room]")
+	fmt.Println("* resume [room]")
+	fmt.Println("* match [room]")
+	fmt.Println("* status")
+	fmt.Println("* logs user <player>")
+	fmt.Println("* logs since <duration>")
+	fmt.Println("* logs grep <text>")
+	fmt.Println("* logstats")
+	fmt.Println("* abusers")
+	fmt.Println("* ban <player>")
+	fmt.Println("* unban <player>")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
@@ -84,9 +122,19 @@ func (gs *GameState) CommandStatus() {
 		fmt.Println("The game is not paused.")
 	}
 
+	if gs.IsTurnMode() {
+		if gs.isRoundClosed() {
+			fmt.Printf("Round %v is closed.\n", gs.GetRound())
+		} else {
+			fmt.Printf("Round %v is accepting orders.\n", gs.GetRound())
+		}
+	}
+
 	p := gs.GetPlayerSnap()
 	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
+	fmt.Printf("You have %v resources and earn %v per tick.\n", gs.GetResources(), incomeFor(p))
 	for _, unit := range p.Units {
 		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
 	}
+	gs.printRelations()
 }
@@ -2,23 +2,72 @@ package gamelogic
 
 import (
 	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/ratelimit"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 type GameState struct {
 	Player Player
 	Paused bool
-	mu     *sync.RWMutex
+	// LastUnitID is the last unit ID handed out to this player. It only ever
+	// grows, so IDs of dead units are never reused.
+	LastUnitID int
+	Resources  int
+	// MatchPhase is the last phase announced by the server. It is empty
+	// until the server announces one.
+	MatchPhase routing.MatchPhase
+	// TurnMode is set once the server starts driving rounds. Round is the
+	// current round number.
+	TurnMode      bool
+	Round         int
+	roundOpen     bool
+	pendingOrders []ArmyOrder
+	// Relations holds the concluded treaty with each other player.
+	Relations      map[string]DiplomacyAction
+	outgoingOffers map[string]DiplomacyAction
+	incomingOffers map[string]DiplomacyAction
+	chatLimiter    *ratelimit.TokenBucket
+	// lastSeq is the sequence number of the last recorded event and
+	// savedSeq that of the last snapshot. unsaved holds the events not yet
+	// appended to the store's log.
+	lastSeq  int
+	savedSeq int
+	unsaved  []Event
+	// store persists the state after every change. It may be nil.
+	store   StateStore
+	flushMu *sync.Mutex
+	mu      *sync.RWMutex
 }
 
-func NewGameState(username string) *GameState {
-	return &GameState{
+// NewGameState creates the state for a player. When store holds a history
+// for username, the player's army is rebuilt from it.
+func NewGameState(username string, store StateStore) (*GameState, error) {
+	gs := &GameState{
 		Player: Player{
 			Username: username,
 			Units:    map[int]Unit{},
 		},
-		Paused: false,
-		mu:     &sync.RWMutex{},
+		Paused:         false,
+		LastUnitID:     0,
+		Resources:      GetWorldMap().StartingResources,
+		Relations:      map[string]DiplomacyAction{},
+		outgoingOffers: map[string]DiplomacyAction{},
+		incomingOffers: map[string]DiplomacyAction{},
+		chatLimiter:    ratelimit.NewTokenBucket(chatBurst, chatPeriod),
+		store:          store,
+		flushMu:        &sync.Mutex{},
+		mu:             &sync.RWMutex{},
+	}
+	if store == nil {
+		return gs, nil
+	}
+
+	err := gs.load()
+	if err != nil {
+		return nil, err
 	}
+	return gs, nil
 }
 
 func (gs *GameState) resumeGame() {
@@ -39,26 +88,41 @@ func (gs *GameState) isPaused() bool {
 	return gs.Paused
 }
 
+// allocateUnitID returns the next unused unit ID for this player.
+func (gs *GameState) allocateUnitID() int {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.LastUnitID++
+	return gs.LastUnitID
+}
+
 func (gs *GameState) addUnit(u Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	gs.Player.Units[u.ID] = u
+	gs.record(Event{Kind: EventUnitSpawned, Unit: u})
 }
 
-func (gs *GameState) removeUnitsInLocation(loc Location) {
+// rejectUnit removes a unit whose spawn the server refused and refunds its
+// cost.
+func (gs *GameState) rejectUnit(u Unit, cost int) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	for k, v := range gs.Player.Units {
-		if v.Location == loc {
-			delete(gs.Player.Units, k)
-		}
-	}
+	gs.record(Event{Kind: EventUnitRejected, Unit: u})
+	gs.record(Event{Kind: EventResourcesChanged, Amount: cost})
+}
+
+// removeUnitsInLocation destroys the player's units in loc after a battle
+// lost to opponent.
+func (gs *GameState) removeUnitsInLocation(loc Location, opponent string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.record(Event{Kind: EventUnitsDestroyed, Location: loc, Other: opponent})
 }
 
 func (gs *GameState) UpdateUnit(u Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	gs.Player.Units[u.ID] = u
+	gs.record(Event{Kind: EventUnitMoved, Unit: u})
 }
 
 func (gs *GameState) GetUsername() string {
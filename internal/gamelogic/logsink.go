@@ -0,0 +1,291 @@
+package gamelogic
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+type LogFormat string
+
+const (
+	// LogFormatText writes "RFC3339 user: message" lines.
+	LogFormatText   LogFormat = "text"
+	LogFormatJSON   LogFormat = "json"
+	LogFormatLogfmt LogFormat = "logfmt"
+)
+
+// rotatedSuffix is the layout of the timestamp appended to rotated files.
+const rotatedSuffix = "20060102T150405.000"
+
+// LogSinkConfig says where and how game logs are written. Zero limits
+// disable rotation and retention.
+type LogSinkConfig struct {
+	Path   string
+	Format LogFormat
+	// MaxSize is the size in bytes after which the file is rotated.
+	MaxSize int64
+	// MaxAge is how long a file is written to before it is rotated.
+	MaxAge time.Duration
+	// Backups is how many rotated files are kept.
+	Backups int
+	// Compress gzips rotated files.
+	Compress bool
+}
+
+// DefaultLogSinkConfig returns the settings used when none are given: text
+// lines appended to game.log forever.
+func DefaultLogSinkConfig() LogSinkConfig {
+	return LogSinkConfig{
+		Path:   "game.log",
+		Format: LogFormatText,
+	}
+}
+
+// GameLogIndex keeps game logs searchable.
+type GameLogIndex interface {
+	Add(gamelogs []routing.GameLog) error
+}
+
+// LogSink appends encoded game logs to a file, rotating it by size or age.
+// Logs are also added to the index, if it has one.
+type LogSink struct {
+	config LogSinkConfig
+	index  GameLogIndex
+	f      *os.File
+	size   int64
+	opened time.Time
+	mu     *sync.Mutex
+}
+
+// NewLogSink opens the file at config.Path for appending.
+func NewLogSink(config LogSinkConfig) (*LogSink, error) {
+	switch config.Format {
+	case LogFormatText, LogFormatJSON, LogFormatLogfmt:
+	default:
+		return nil, fmt.Errorf("unknown log format %q: use text, json or logfmt", config.Format)
+	}
+	if config.Path == "" {
+		return nil, fmt.Errorf("log path must not be empty")
+	}
+
+	s := &LogSink{
+		config: config,
+		mu:     &sync.Mutex{},
+	}
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetIndex makes the sink add every log it writes to idx.
+func (s *LogSink) SetIndex(idx GameLogIndex) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index = idx
+}
+
+// Write appends gamelogs in a single write and syncs the file, rotating it
+// first if it is full or too old. The file is the record of the logs, so a
+// failure to index them is reported rather than returned.
+func (s *LogSink) Write(gamelogs []routing.GameLog) error {
+	var sb strings.Builder
+	for _, gamelog := range gamelogs {
+		sb.WriteString(s.encode(gamelog))
+	}
+	data := sb.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		err := s.open()
+		if err != nil {
+			return err
+		}
+	}
+	if s.due(int64(len(data))) {
+		err := s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.WriteString(data)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("could not write to logs file: %v", err)
+	}
+	err = s.f.Sync()
+	if err != nil {
+		return fmt.Errorf("could not sync logs file: %v", err)
+	}
+
+	if s.index != nil {
+		err = s.index.Add(gamelogs)
+		if err != nil {
+			fmt.Printf("failed to index game logs: %v\n", err)
+		}
+	}
+	return nil
+}
+
+func (s *LogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *LogSink) encode(gamelog routing.GameLog) string {
+	switch s.config.Format {
+	case LogFormatJSON:
+		data, _ := json.Marshal(struct {
+			Time    time.Time `json:"time"`
+			User    string    `json:"user"`
+			Message string    `json:"message"`
+		}{gamelog.CurrentTime, gamelog.Username, gamelog.Message})
+		return string(data) + "\n"
+	case LogFormatLogfmt:
+		return fmt.Sprintf("time=%s user=%s message=%s\n",
+			gamelog.CurrentTime.Format(time.RFC3339),
+			logfmtValue(gamelog.Username),
+			logfmtValue(gamelog.Message),
+		)
+	}
+	return formatLog(gamelog)
+}
+
+// logfmtValue quotes v when it can not be written bare.
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\\\t\n") {
+		return fmt.Sprintf("%q", v)
+	}
+	return v
+}
+
+// due reports whether the file must be rotated before n more bytes are
+// written. An empty file is never rotated for size, so a single large
+// batch can not rotate forever.
+func (s *LogSink) due(n int64) bool {
+	if s.config.MaxSize > 0 && s.size > 0 && s.size+n > s.config.MaxSize {
+		return true
+	}
+	if s.config.MaxAge > 0 && time.Since(s.opened) > s.config.MaxAge {
+		return true
+	}
+	return false
+}
+
+func (s *LogSink) open() error {
+	f, err := os.OpenFile(s.config.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	s.f = f
+	s.size = info.Size()
+	s.opened = time.Now()
+	return nil
+}
+
+// rotate renames the current file with a timestamp, compresses it if
+// configured, removes the backups beyond the retention limit and opens a
+// new file. The caller must hold s.mu.
+func (s *LogSink) rotate() error {
+	err := s.f.Close()
+	s.f = nil
+	if err != nil {
+		return fmt.Errorf("could not close logs file: %v", err)
+	}
+
+	rotated := s.config.Path + "." + time.Now().Format(rotatedSuffix)
+	err = os.Rename(s.config.Path, rotated)
+	if err != nil {
+		return fmt.Errorf("could not rotate logs file: %v", err)
+	}
+	if s.config.Compress {
+		err = gzipFile(rotated)
+		if err != nil {
+			// Keep the uncompressed file rather than losing logs.
+			fmt.Printf("failed to compress %s: %v\n", rotated, err)
+		}
+	}
+
+	err = s.prune()
+	if err != nil {
+		fmt.Printf("failed to remove old logs: %v\n", err)
+	}
+	return s.open()
+}
+
+// prune removes the oldest rotated files beyond the retention limit.
+func (s *LogSink) prune() error {
+	if s.config.Backups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(s.config.Path + ".*")
+	if err != nil {
+		return err
+	}
+	// Rotated names end in a sortable timestamp, so name order is age
+	// order.
+	sort.Strings(backups)
+	for len(backups) > s.config.Backups {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// gzipFile compresses path to path.gz and removes path.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	closeErr := dst.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
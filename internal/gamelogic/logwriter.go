@@ -0,0 +1,157 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// FlushStats describes how long the writer takes to get batches to disk.
+type FlushStats struct {
+	Flushes      int
+	Entries      int
+	Failures     int
+	LastLatency  time.Duration
+	MaxLatency   time.Duration
+	TotalLatency time.Duration
+}
+
+// AvgLatency returns the mean time a flush took.
+func (s FlushStats) AvgLatency() time.Duration {
+	if s.Flushes == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Flushes)
+}
+
+// pendingLog is a log waiting to be flushed and the function told whether
+// it made it to disk.
+type pendingLog struct {
+	gamelog routing.GameLog
+	done    func(error)
+}
+
+// GameLogWriter batches game logs and appends them to a sink, flushing
+// once maxBatch logs are waiting or every interval, whichever comes first.
+// Each log's done function is called only after its batch has been synced
+// to disk, so that a delivery can be acknowledged once the log is safe.
+type GameLogWriter struct {
+	sink     *LogSink
+	maxBatch int
+	pending  []pendingLog
+	stats    FlushStats
+	// flushNow wakes the flush loop when a batch is full.
+	flushNow chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+	mu       *sync.Mutex
+	// flushMu keeps batches in order.
+	flushMu *sync.Mutex
+}
+
+// NewGameLogWriter starts a writer appending to sink.
+func NewGameLogWriter(sink *LogSink, maxBatch int, interval time.Duration) *GameLogWriter {
+	w := &GameLogWriter{
+		sink:     sink,
+		maxBatch: maxBatch,
+		flushNow: make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		mu:       &sync.Mutex{},
+		flushMu:  &sync.Mutex{},
+	}
+	go w.loop(interval)
+	return w
+}
+
+// Write queues gamelog for the next flush. done is called with the result of
+// that flush.
+func (w *GameLogWriter) Write(gamelog routing.GameLog, done func(error)) {
+	w.mu.Lock()
+	w.pending = append(w.pending, pendingLog{gamelog: gamelog, done: done})
+	full := len(w.pending) >= w.maxBatch
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.flushNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stats returns the flush statistics so far.
+func (w *GameLogWriter) Stats() FlushStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// Close flushes any waiting logs and stops the writer.
+func (w *GameLogWriter) Close() error {
+	close(w.stop)
+	<-w.stopped
+	return w.Flush()
+}
+
+func (w *GameLogWriter) loop(interval time.Duration) {
+	defer close(w.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		case <-w.flushNow:
+		}
+		err := w.Flush()
+		if err != nil {
+			fmt.Printf("failed to flush game logs: %v\n", err)
+		}
+	}
+}
+
+// Flush appends every waiting log to the sink in a single write, which syncs
+// it, and reports the result to each log's done function.
+func (w *GameLogWriter) Flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	gamelogs := make([]routing.GameLog, 0, len(batch))
+	for _, p := range batch {
+		gamelogs = append(gamelogs, p.gamelog)
+	}
+	err := w.sink.Write(gamelogs)
+	latency := time.Since(start)
+
+	w.mu.Lock()
+	if err != nil {
+		w.stats.Failures++
+	} else {
+		w.stats.Flushes++
+		w.stats.Entries += len(batch)
+		w.stats.LastLatency = latency
+		w.stats.TotalLatency += latency
+		if latency > w.stats.MaxLatency {
+			w.stats.MaxLatency = latency
+		}
+	}
+	w.mu.Unlock()
+
+	for _, p := range batch {
+		p.done(err)
+	}
+	return err
+}
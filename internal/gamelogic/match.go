@@ -0,0 +1,449 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// WinConditions configures how a match is won. Zero values disable a
+// condition.
+type WinConditions struct {
+	// HoldTerritories wins the match for the first player holding at least
+	// this many territories.
+	HoldTerritories int
+	// Elimination wins the match for the last player with units once at
+	// least two players have taken part.
+	Elimination bool
+	// TimeLimit ends the match after this much running time, won by the
+	// player with the highest score.
+	TimeLimit time.Duration
+}
+
+// Match is the server's view of the match lifecycle. It follows every
+// player's army by applying the spawn, move and war messages it observes and
+// checks the win conditions after each one.
+type Match struct {
+	conditions WinConditions
+	phase      routing.MatchPhase
+	winner     string
+	reason     string
+	players    map[string]Player
+	spawned    spawnLog
+	// elapsed is the running time accumulated before startedAt.
+	elapsed   time.Duration
+	startedAt time.Time
+	mu        *sync.Mutex
+}
+
+func NewMatch(conditions WinConditions, lobby bool) *Match {
+	m := &Match{
+		conditions: conditions,
+		phase:      routing.MatchRunning,
+		players:    map[string]Player{},
+		spawned:    spawnLog{},
+		startedAt:  time.Now(),
+		mu:         &sync.Mutex{},
+	}
+	if lobby {
+		m.phase = routing.MatchLobby
+	}
+	return m
+}
+
+func (m *Match) Phase() routing.MatchPhase {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.phase
+}
+
+// Event returns the event describing the match's current phase.
+func (m *Match) Event() routing.MatchEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.event()
+}
+
+func (m *Match) event() routing.MatchEvent {
+	return routing.MatchEvent{
+		Phase:  m.phase,
+		Winner: m.winner,
+		Reason: m.reason,
+	}
+}
+
+// Start moves the match out of the lobby.
+func (m *Match) Start() (routing.MatchEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.phase != routing.MatchLobby {
+		return routing.MatchEvent{}, fmt.Errorf("match is %s, not in the lobby", m.phase)
+	}
+	m.phase = routing.MatchRunning
+	m.startedAt = time.Now()
+	return m.event(), nil
+}
+
+// Pause stops the match clock.
+func (m *Match) Pause() (routing.MatchEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.phase != routing.MatchRunning {
+		return routing.MatchEvent{}, fmt.Errorf("match is %s, not running", m.phase)
+	}
+	m.elapsed += time.Since(m.startedAt)
+	m.phase = routing.MatchPaused
+	return m.event(), nil
+}
+
+// Resume restarts the match clock.
+func (m *Match) Resume() (routing.MatchEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.phase != routing.MatchPaused {
+		return routing.MatchEvent{}, fmt.Errorf("match is %s, not paused", m.phase)
+	}
+	m.startedAt = time.Now()
+	m.phase = routing.MatchRunning
+	return m.event(), nil
+}
+
+// ObserveSpawn adds a spawned unit to the match's view of its owner's army
+// and checks the win conditions. It returns true along with the final event
+// when this spawn finished the match. A spawn reusing a unit ID is refused
+// with an error, and one delivered again under the same message ID with
+// ErrDuplicateSpawn.
+func (m *Match) ObserveSpawn(messageID string, spawn UnitSpawned) (routing.MatchEvent, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.spawned.check(messageID, spawn)
+	if err != nil {
+		return routing.MatchEvent{}, false, err
+	}
+	m.spawned.add(messageID, spawn)
+	p := m.knownPlayer(spawn.Username)
+	p.Units[spawn.Unit.ID] = spawn.Unit
+	m.players[p.Username] = p
+	event, finished := m.check()
+	return event, finished, nil
+}
+
+// ObserveMove updates the location of every moved unit and checks the win
+// conditions. The move must already have passed ValidateMove. A move of
+// another player's unit, or of a unit from somewhere other than where the
+// match last saw it, is refused with an error and changes nothing.
+func (m *Match) ObserveMove(move ArmyMove) (routing.MatchEvent, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.knownPlayer(move.Username)
+	for _, unit := range move.Units {
+		if unit.Owner != move.Username {
+			return routing.MatchEvent{}, false, fmt.Errorf("%s moved unit %s owned by someone else", move.Username, unit.Ref())
+		}
+		known, ok := p.Units[unit.ID]
+		if ok && known.Location != move.Origins[unit.ID] {
+			return routing.MatchEvent{}, false, &MoveRejectedError{Unit: unit, From: move.Origins[unit.ID], To: move.ToLocation, Reason: fmt.Sprintf("unit is in %s", known.Location)}
+		}
+	}
+	for _, unit := range move.Units {
+		p.Units[unit.ID] = unit
+	}
+	m.players[p.Username] = p
+	event, finished := m.check()
+	return event, finished, nil
+}
+
+// ResolveOrders carries out every order given in a round at once. Each order
+// moves the units its player still has that can reach the destination from
+// where they stood when the round ended; a unit given several orders follows
+// the first. It returns the resulting moves, and true along with the final
+// event when they finished the match.
+func (m *Match) ResolveOrders(orders []ArmyOrder) ([]ArmyMove, routing.MatchEvent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	moves := []ArmyMove{}
+	ordered := map[UnitRef]struct{}{}
+	for _, o := range orders {
+		p, ok := m.players[o.Username]
+		if !ok {
+			continue
+		}
+		move := ArmyMove{
+			Username:   o.Username,
+			ToLocation: o.ToLocation,
+			Origins:    map[int]Location{},
+		}
+		for _, id := range o.UnitIDs {
+			unit, ok := p.Units[id]
+			if !ok {
+				continue
+			}
+			ref := UnitRef{Owner: o.Username, ID: id}
+			if _, ok := ordered[ref]; ok {
+				continue
+			}
+			if validateUnitMove(unit, unit.Location, o.ToLocation) != nil {
+				continue
+			}
+			ordered[ref] = struct{}{}
+			move.Origins[id] = unit.Location
+			unit.Location = o.ToLocation
+			move.Units = append(move.Units, unit)
+		}
+		if len(move.Units) > 0 {
+			moves = append(moves, move)
+		}
+	}
+
+	// Every move was worked out before any is applied, so no order sees
+	// the outcome of another.
+	for _, move := range moves {
+		for _, unit := range move.Units {
+			m.players[move.Username].Units[unit.ID] = unit
+		}
+	}
+	ev, finished := m.check()
+	return moves, ev, finished
+}
+
+// ObserveWar removes the units each side lost in rw from the match's view of
+// their armies and checks the win conditions. The recognition only carries
+// part of each army, so battles are fought with the armies the match has
+// followed.
+func (m *Match) ObserveWar(rw RecognitionOfWar) (routing.MatchEvent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attacker := m.knownPlayer(rw.Attacker.Username)
+	defender := m.knownPlayer(rw.Defender.Username)
+	for id, unit := range rw.Defender.Units {
+		defender.Units[id] = unit
+	}
+	for _, loc := range getOverlappingLocations(attacker, defender) {
+		attackerPower := unitsToPowerLevel(unitsInLocation(attacker, loc))
+		defenderPower := unitsToPowerLevel(unitsInLocation(defender, loc))
+		if attackerPower <= defenderPower {
+			removeUnitsInLocation(attacker, loc)
+		}
+		if defenderPower <= attackerPower {
+			removeUnitsInLocation(defender, loc)
+		}
+	}
+	m.players[attacker.Username] = attacker
+	m.players[defender.Username] = defender
+	return m.check()
+}
+
+// Players returns a copy of every army the match has followed.
+func (m *Match) Players() []Player {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	players := []Player{}
+	for username := range m.players {
+		players = append(players, m.knownPlayer(username))
+	}
+	return players
+}
+
+// VisibleTo returns every other player who can see either end of move.
+func (m *Match) VisibleTo(move ArmyMove) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usernames := []string{}
+	for username, p := range m.players {
+		if username == move.Username {
+			continue
+		}
+		if CanSeeMove(p, move) {
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// SpawnVisibleTo returns every other player who can see where spawn landed.
+func (m *Match) SpawnVisibleTo(spawn UnitSpawned) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usernames := []string{}
+	for username, p := range m.players {
+		if username == spawn.Username {
+			continue
+		}
+		if CanSeeSpawn(p, spawn) {
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// CheckTime ends the match if the time limit has passed.
+func (m *Match) CheckTime() (routing.MatchEvent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.check()
+}
+
+// Scores returns every known player's score, highest first.
+func (m *Match) Scores() []PlayerScore {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.scores()
+}
+
+// knownPlayer returns a copy of the match's view of a player's army, which
+// is empty for a player seen for the first time.
+func (m *Match) knownPlayer(username string) Player {
+	units := map[int]Unit{}
+	for k, v := range m.players[username].Units {
+		units[k] = v
+	}
+	return Player{Username: username, Units: units}
+}
+
+func removeUnitsInLocation(p Player, loc Location) {
+	for k, v := range p.Units {
+		if v.Location == loc {
+			delete(p.Units, k)
+		}
+	}
+}
+
+// check evaluates the win conditions and finishes the match if one is met.
+func (m *Match) check() (routing.MatchEvent, bool) {
+	if m.phase != routing.MatchRunning {
+		return routing.MatchEvent{}, false
+	}
+
+	if m.conditions.HoldTerritories > 0 {
+		for _, s := range m.scores() {
+			if s.Territories >= m.conditions.HoldTerritories {
+				return m.finish(s.Username, fmt.Sprintf("holds %v territories", s.Territories)), true
+			}
+		}
+	}
+
+	if m.conditions.Elimination && len(m.players) >= 2 {
+		alive := []string{}
+		for username, p := range m.players {
+			if len(p.Units) > 0 {
+				alive = append(alive, username)
+			}
+		}
+		if len(alive) == 1 {
+			return m.finish(alive[0], "eliminated all opponents"), true
+		}
+	}
+
+	if m.conditions.TimeLimit > 0 && m.elapsed+time.Since(m.startedAt) >= m.conditions.TimeLimit {
+		scores := m.scores()
+		if len(scores) == 0 {
+			return m.finish("", "time limit reached with no players"), true
+		}
+		return m.finish(scores[0].Username, fmt.Sprintf("highest score (%v) at the time limit", scores[0].Score)), true
+	}
+	return routing.MatchEvent{}, false
+}
+
+func (m *Match) finish(winner, reason string) routing.MatchEvent {
+	m.phase = routing.MatchFinished
+	m.winner = winner
+	m.reason = reason
+	return m.event()
+}
+
+// PlayerScore summarises a player's standing in the match.
+type PlayerScore struct {
+	Username    string
+	Territories int
+	Power       int
+	// Score is five points per territory held plus the army's power level.
+	Score int
+}
+
+func (m *Match) scores() []PlayerScore {
+	scores := []PlayerScore{}
+	for username, p := range m.players {
+		held := map[Location]struct{}{}
+		units := []Unit{}
+		for _, unit := range p.Units {
+			held[unit.Location] = struct{}{}
+			units = append(units, unit)
+		}
+		power := unitsToPowerLevel(units)
+		scores = append(scores, PlayerScore{
+			Username:    username,
+			Territories: len(held),
+			Power:       power,
+			Score:       len(held)*5 + power,
+		})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Username < scores[j].Username
+	})
+	return scores
+}
+
+// HandleMatch updates the client's view of the match and prints the event.
+func (gs *GameState) HandleMatch(ev routing.MatchEvent) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+
+	gs.mu.Lock()
+	gs.MatchPhase = ev.Phase
+	gs.mu.Unlock()
+
+	switch ev.Phase {
+	case routing.MatchLobby:
+		fmt.Println("==== Match Lobby ====")
+		fmt.Println("The match has not started yet. You may spawn units but not move them.")
+	case routing.MatchRunning:
+		fmt.Println("==== Match Running ====")
+	case routing.MatchPaused:
+		fmt.Println("==== Match Paused ====")
+	case routing.MatchFinished:
+		fmt.Println("==== Match Finished ====")
+		if ev.Winner == "" {
+			fmt.Printf("Nobody won: %s.\n", ev.Reason)
+		} else if ev.Winner == gs.GetUsername() {
+			fmt.Printf("You won the match: %s!\n", ev.Reason)
+		} else {
+			fmt.Printf("%s won the match: %s.\n", ev.Winner, ev.Reason)
+		}
+	}
+}
+
+func (gs *GameState) getMatchPhase() routing.MatchPhase {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.MatchPhase
+}
+
+// checkCanMove returns an error if the match does not allow moving units.
+func (gs *GameState) checkCanMove() error {
+	switch gs.getMatchPhase() {
+	case routing.MatchLobby:
+		return errors.New("the match has not started, you can not move units")
+	case routing.MatchFinished:
+		return errors.New("the match is over, you can not move units")
+	}
+	return nil
+}
+
+// checkCanSpawn returns an error if the match does not allow spawning units.
+func (gs *GameState) checkCanSpawn() error {
+	if gs.getMatchPhase() == routing.MatchFinished {
+		return errors.New("the match is over, you can not spawn units")
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package gamelogic
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// newTestMatch returns a running match, with no win conditions, that has
+// observed the spawn of every unit.
+func newTestMatch(t *testing.T, units ...Unit) *Match {
+	t.Helper()
+	m := NewMatch(WinConditions{}, false)
+	for i, u := range units {
+		_, _, err := m.ObserveSpawn(string(rune('a'+i)), UnitSpawned{Username: u.Owner, Unit: u})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// locations returns where the match last saw each unit.
+func locations(m *Match) map[UnitRef]Location {
+	locs := map[UnitRef]Location{}
+	for _, p := range m.Players() {
+		for _, u := range p.Units {
+			locs[u.Ref()] = u.Location
+		}
+	}
+	return locs
+}
+
+func TestResolveOrders(t *testing.T) {
+	units := []Unit{
+		unit("alice", 1, RankInfantry, "europe"),
+		unit("alice", 2, RankCavalry, "europe"),
+		unit("bob", 1, RankInfantry, "asia"),
+	}
+	alice1, alice2, bob1 := units[0].Ref(), units[1].Ref(), units[2].Ref()
+	cases := []struct {
+		name      string
+		orders    []ArmyOrder
+		wantMoves []ArmyMove
+		wantLocs  map[UnitRef]Location
+	}{
+		{
+			name:      "no orders",
+			wantMoves: []ArmyMove{},
+			wantLocs:  map[UnitRef]Location{alice1: "europe", alice2: "europe", bob1: "asia"},
+		},
+		{
+			name: "orders are carried out at once",
+			orders: []ArmyOrder{
+				{Username: "alice", ToLocation: "asia", UnitIDs: []int{1}},
+				{Username: "bob", ToLocation: "europe", UnitIDs: []int{1}},
+			},
+			wantMoves: []ArmyMove{
+				{Username: "alice", ToLocation: "asia", Units: []Unit{unit("alice", 1, RankInfantry, "asia")}, Origins: map[int]Location{1: "europe"}},
+				{Username: "bob", ToLocation: "europe", Units: []Unit{unit("bob", 1, RankInfantry, "europe")}, Origins: map[int]Location{1: "asia"}},
+			},
+			wantLocs: map[UnitRef]Location{alice1: "asia", alice2: "europe", bob1: "europe"},
+		},
+		{
+			name: "a unit given several orders follows the first",
+			orders: []ArmyOrder{
+				{Username: "alice", ToLocation: "africa", UnitIDs: []int{1}},
+				{Username: "alice", ToLocation: "asia", UnitIDs: []int{1, 2}},
+			},
+			wantMoves: []ArmyMove{
+				{Username: "alice", ToLocation: "africa", Units: []Unit{unit("alice", 1, RankInfantry, "africa")}, Origins: map[int]Location{1: "europe"}},
+				{Username: "alice", ToLocation: "asia", Units: []Unit{unit("alice", 2, RankCavalry, "asia")}, Origins: map[int]Location{2: "europe"}},
+			},
+			wantLocs: map[UnitRef]Location{alice1: "africa", alice2: "asia", bob1: "asia"},
+		},
+		{
+			name: "units out of range stay",
+			orders: []ArmyOrder{
+				{Username: "alice", ToLocation: "australia", UnitIDs: []int{1, 2}},
+			},
+			wantMoves: []ArmyMove{
+				{Username: "alice", ToLocation: "australia", Units: []Unit{unit("alice", 2, RankCavalry, "australia")}, Origins: map[int]Location{2: "europe"}},
+			},
+			wantLocs: map[UnitRef]Location{alice1: "europe", alice2: "australia", bob1: "asia"},
+		},
+		{
+			name: "unknown players and units are ignored",
+			orders: []ArmyOrder{
+				{Username: "carol", ToLocation: "asia", UnitIDs: []int{1}},
+				{Username: "bob", ToLocation: "europe", UnitIDs: []int{2}},
+			},
+			wantMoves: []ArmyMove{},
+			wantLocs:  map[UnitRef]Location{alice1: "europe", alice2: "europe", bob1: "asia"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := newTestMatch(t, units...)
+			moves, _, finished := m.ResolveOrders(c.orders)
+			if finished {
+				t.Error("ResolveOrders() finished a match without win conditions")
+			}
+			if !reflect.DeepEqual(moves, c.wantMoves) {
+				t.Errorf("moves = %+v, want %+v", moves, c.wantMoves)
+			}
+			if got := locations(m); !reflect.DeepEqual(got, c.wantLocs) {
+				t.Errorf("locations = %v, want %v", got, c.wantLocs)
+			}
+		})
+	}
+}
+
+func TestResolveOrdersFinishesMatch(t *testing.T) {
+	m := NewMatch(WinConditions{HoldTerritories: 2}, false)
+	for i, u := range []Unit{unit("alice", 1, RankInfantry, "europe"), unit("alice", 2, RankInfantry, "europe")} {
+		_, _, err := m.ObserveSpawn(string(rune('a'+i)), UnitSpawned{Username: "alice", Unit: u})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, ev, finished := m.ResolveOrders([]ArmyOrder{{Username: "alice", ToLocation: "asia", UnitIDs: []int{2}}})
+	if !finished || ev.Winner != "alice" {
+		t.Errorf("ResolveOrders() = %+v, %v, want alice to win", ev, finished)
+	}
+}
+
+func TestObserveSpawn(t *testing.T) {
+	infantry := unit("alice", 1, RankInfantry, "europe")
+	cases := []struct {
+		name      string
+		messageID string
+		spawn     UnitSpawned
+		wantErr   error
+		wantLoc   Location
+	}{
+		{"new unit", "m2", UnitSpawned{Username: "alice", Unit: unit("alice", 2, RankInfantry, "asia")}, nil, "europe"},
+		{"redelivery", "m1", UnitSpawned{Username: "alice", Unit: infantry}, ErrDuplicateSpawn, "europe"},
+		{"redelivery with other content", "m1", UnitSpawned{Username: "alice", Unit: unit("alice", 1, RankArtillery, "asia")}, ErrDuplicateSpawn, "europe"},
+		{"reused unit ID", "m2", UnitSpawned{Username: "alice", Unit: unit("alice", 1, RankArtillery, "asia")}, errAny, "europe"},
+		{"same ID for another player", "m2", UnitSpawned{Username: "bob", Unit: unit("bob", 1, RankInfantry, "asia")}, nil, "europe"},
+		{"unit of another player", "m2", UnitSpawned{Username: "bob", Unit: unit("alice", 3, RankInfantry, "asia")}, errAny, "europe"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := NewMatch(WinConditions{}, false)
+			_, _, err := m.ObserveSpawn("m1", UnitSpawned{Username: "alice", Unit: infantry})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = m.ObserveSpawn(c.messageID, c.spawn)
+			checkErr(t, err, c.wantErr)
+			if got := locations(m)[infantry.Ref()]; got != c.wantLoc {
+				t.Errorf("%s is in %s, want %s", infantry.Ref(), got, c.wantLoc)
+			}
+		})
+	}
+}
+
+func TestObserveMove(t *testing.T) {
+	cases := []struct {
+		name    string
+		move    ArmyMove
+		wantErr error
+		wantLoc Location
+	}{
+		{
+			name:    "move from where the unit is",
+			move:    ArmyMove{Username: "alice", ToLocation: "asia", Units: []Unit{unit("alice", 1, RankInfantry, "asia")}, Origins: map[int]Location{1: "europe"}},
+			wantLoc: "asia",
+		},
+		{
+			name:    "move from elsewhere",
+			move:    ArmyMove{Username: "alice", ToLocation: "australia", Units: []Unit{unit("alice", 1, RankInfantry, "australia")}, Origins: map[int]Location{1: "asia"}},
+			wantErr: errAny,
+			wantLoc: "europe",
+		},
+		{
+			name:    "move of another player's unit",
+			move:    ArmyMove{Username: "bob", ToLocation: "asia", Units: []Unit{unit("alice", 1, RankInfantry, "asia")}, Origins: map[int]Location{1: "europe"}},
+			wantErr: errAny,
+			wantLoc: "europe",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := newTestMatch(t, unit("alice", 1, RankInfantry, "europe"))
+			_, _, err := m.ObserveMove(c.move)
+			checkErr(t, err, c.wantErr)
+			if got := locations(m)[UnitRef{Owner: "alice", ID: 1}]; got != c.wantLoc {
+				t.Errorf("unit is in %s, want %s", got, c.wantLoc)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in test cases.
+var errAny = errors.New("any error")
+
+func checkErr(t *testing.T, err, want error) {
+	t.Helper()
+	switch {
+	case want == nil && err != nil:
+		t.Errorf("error = %v, want nil", err)
+	case want == errAny && err == nil:
+		t.Error("error = nil, want an error")
+	case want != nil && want != errAny && !errors.Is(err, want):
+		t.Errorf("error = %v, want %v", err, want)
+	}
+}
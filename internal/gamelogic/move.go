@@ -3,6 +3,7 @@ package gamelogic
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 )
 
@@ -12,6 +13,7 @@ const (
 	MoveOutcomeSamePlayer MoveOutcome = iota
 	MoveOutComeSafe
 	MoveOutcomeMakeWar
+	MoveOutcomeRejected
 )
 
 func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
@@ -20,73 +22,142 @@ func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
 
 	fmt.Println()
 	fmt.Println("==== Move Detected ====")
-	fmt.Printf("%s is moving %v unit(s) to %s\n", move.Player.Username, len(move.Units), move.ToLocation)
-	for _, unit := range move.Units {
-		fmt.Printf("* %v\n", unit.Rank)
+	visible := player.Username == move.Username || CanSeeMove(player, move)
+	if visible {
+		fmt.Printf("%s is moving %v unit(s) to %s\n", move.Username, len(move.Units), move.ToLocation)
+		for _, unit := range move.Units {
+			fmt.Printf("* %v\n", unit.Rank)
+		}
+	} else {
+		fmt.Printf("%s is moving units somewhere out of sight.\n", move.Username)
 	}
 
-	if player.Username == move.Player.Username {
+	if player.Username == move.Username {
 		return MoveOutcomeSamePlayer
 	}
 
-	overlappingLocation := getOverlappingLocation(player, move.Player)
-	if overlappingLocation != "" {
-		fmt.Printf("You have units in %s! You are at war with %s!\n", overlappingLocation, move.Player.Username)
+	err := ValidateMove(move)
+	if err != nil {
+		fmt.Printf("Rejected move from %s: %v\n", move.Username, err)
+		return MoveOutcomeRejected
+	}
+
+	if relation, ok := gs.hasTreaty(move.Username); ok {
+		fmt.Printf("You have a(n) %s treaty with %s. No war will be declared.\n", relation, move.Username)
+		return MoveOutComeSafe
+	}
+
+	overlappingLocations := getOverlappingLocations(player, move.Sender())
+	if len(overlappingLocations) > 0 {
+		for _, loc := range overlappingLocations {
+			fmt.Printf("You have units in %s! You are at war with %s!\n", loc, move.Username)
+		}
 		return MoveOutcomeMakeWar
 	}
-	fmt.Printf("You are safe from %s's units.\n", move.Player.Username)
+	fmt.Printf("You are safe from %s's units.\n", move.Username)
 	return MoveOutComeSafe
 }
 
-func getOverlappingLocation(p1 Player, p2 Player) Location {
+// getOverlappingLocations returns every location in which both players have
+// at least one unit, sorted so that callers see a stable order.
+func getOverlappingLocations(p1 Player, p2 Player) []Location {
+	p2Locations := map[Location]struct{}{}
+	for _, u2 := range p2.Units {
+		p2Locations[u2.Location] = struct{}{}
+	}
+
+	seen := map[Location]struct{}{}
+	locations := []Location{}
 	for _, u1 := range p1.Units {
-		for _, u2 := range p2.Units {
-			if u1.Location == u2.Location {
-				return u1.Location
-			}
+		if _, ok := p2Locations[u1.Location]; !ok {
+			continue
+		}
+		if _, ok := seen[u1.Location]; ok {
+			continue
 		}
+		seen[u1.Location] = struct{}{}
+		locations = append(locations, u1.Location)
 	}
-	return ""
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i] < locations[j]
+	})
+	return locations
 }
 
 func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
+	newLocation, units, err := gs.parseMove(words)
+	if err != nil {
+		return ArmyMove{}, err
+	}
+	if gs.IsTurnMode() {
+		return ArmyMove{}, errors.New("the game is played in rounds, moves are given as orders")
+	}
+
+	mv := gs.applyMove(newLocation, units)
+	fmt.Printf("Moved %v units to %s\n", len(mv.Units), mv.ToLocation)
+	return mv, nil
+}
+
+// parseMove checks a move command, whether carried out at once or given as
+// an order, and returns its destination and the units to move.
+func (gs *GameState) parseMove(words []string) (Location, []Unit, error) {
 	if gs.isPaused() {
-		return ArmyMove{}, errors.New("the game is paused, you can not move units")
+		return "", nil, errors.New("the game is paused, you can not move units")
+	}
+	err := gs.checkCanMove()
+	if err != nil {
+		return "", nil, err
 	}
 	if len(words) < 3 {
-		return ArmyMove{}, errors.New("usage: move <location> <unitID> <unitID> <unitID> etc")
+		return "", nil, errors.New("usage: move <location> <unitID> <unitID> <unitID> etc")
 	}
 	newLocation := Location(words[1])
 	locations := getAllLocations()
 	if _, ok := locations[newLocation]; !ok {
-		return ArmyMove{}, fmt.Errorf("error: %s is not a valid location", newLocation)
+		return "", nil, fmt.Errorf("error: %s is not a valid location", newLocation)
 	}
 	unitIDs := []int{}
 	for _, word := range words[2:] {
 		id := word
 		unitID, err := strconv.Atoi(id)
 		if err != nil {
-			return ArmyMove{}, fmt.Errorf("error: %s is not a valid unit ID", id)
+			return "", nil, fmt.Errorf("error: %s is not a valid unit ID", id)
 		}
 		unitIDs = append(unitIDs, unitID)
 	}
 
-	newUnits := []Unit{}
+	// Validate every unit before moving any of them.
+	units := []Unit{}
 	for _, unitID := range unitIDs {
 		unit, ok := gs.GetUnit(unitID)
 		if !ok {
-			return ArmyMove{}, fmt.Errorf("error: unit with ID %v not found", unitID)
+			return "", nil, fmt.Errorf("error: unit with ID %v not found", unitID)
+		}
+		err := validateUnitMove(unit, unit.Location, newLocation)
+		if err != nil {
+			return "", nil, err
 		}
+		units = append(units, unit)
+	}
+	return newLocation, units, nil
+}
+
+// applyMove moves units to newLocation and returns the move to publish.
+func (gs *GameState) applyMove(newLocation Location, units []Unit) ArmyMove {
+	newUnits := []Unit{}
+	origins := map[int]Location{}
+	for _, unit := range units {
+		origins[unit.ID] = unit.Location
 		unit.Location = newLocation
 		gs.UpdateUnit(unit)
 		newUnits = append(newUnits, unit)
 	}
+	gs.persist()
 
-	mv := ArmyMove{
+	return ArmyMove{
 		ToLocation: newLocation,
 		Units:      newUnits,
-		Player:     gs.GetPlayerSnap(),
+		Username:   gs.GetUsername(),
+		Origins:    origins,
 	}
-	fmt.Printf("Moved %v units to %s\n", len(mv.Units), mv.ToLocation)
-	return mv, nil
 }
@@ -0,0 +1,171 @@
+package gamelogic
+
+import (
+	"fmt"
+)
+
+// snapshotEvery is how many events are appended to the log between two
+// snapshots. Restoring a player only folds the events after the last one.
+const snapshotEvery = 20
+
+// GameSnapshot is the part of a GameState that survives a client restart.
+// Round, pause and match state are announced by the server again on
+// reconnect and are not saved.
+type GameSnapshot struct {
+	Player     Player
+	LastUnitID int
+	Resources  int
+	Relations  map[string]DiplomacyAction
+	// Seq is the sequence number of the last event folded into the
+	// snapshot.
+	Seq int
+}
+
+// StateStore persists the event log of each player along with snapshots
+// keyed by username.
+type StateStore interface {
+	// Load returns the snapshot saved for username. The boolean is false
+	// when nothing has been saved yet.
+	Load(username string) (GameSnapshot, bool, error)
+	Save(snapshot GameSnapshot) error
+	// Append adds events to the end of their player's log.
+	Append(events []Event) error
+	// Events returns the events logged for username with a sequence number
+	// greater than after, in order.
+	Events(username string, after int) ([]Event, error)
+	Close() error
+}
+
+// Snapshot returns a copy of the state to persist.
+func (gs *GameState) Snapshot() GameSnapshot {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	units := map[int]Unit{}
+	for k, v := range gs.Player.Units {
+		units[k] = v
+	}
+	relations := map[string]DiplomacyAction{}
+	for k, v := range gs.Relations {
+		relations[k] = v
+	}
+	return GameSnapshot{
+		Player: Player{
+			Username: gs.Player.Username,
+			Units:    units,
+		},
+		LastUnitID: gs.LastUnitID,
+		Resources:  gs.Resources,
+		Relations:  relations,
+		Seq:        gs.lastSeq,
+	}
+}
+
+func (gs *GameState) restore(snapshot GameSnapshot) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if snapshot.Player.Units != nil {
+		gs.Player.Units = snapshot.Player.Units
+	}
+	gs.LastUnitID = snapshot.LastUnitID
+	gs.Resources = snapshot.Resources
+	if snapshot.Relations != nil {
+		gs.Relations = snapshot.Relations
+	}
+	gs.lastSeq = snapshot.Seq
+	gs.savedSeq = snapshot.Seq
+}
+
+// load rebuilds the state from the latest snapshot and the events logged
+// after it.
+func (gs *GameState) load() error {
+	snapshot, ok, err := gs.store.Load(gs.GetUsername())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		snapshot = NewSnapshot(gs.GetUsername())
+	}
+	events, err := gs.store.Events(gs.GetUsername(), snapshot.Seq)
+	if err != nil {
+		return err
+	}
+	if !ok && len(events) == 0 {
+		return nil
+	}
+	gs.restore(Fold(snapshot, events))
+	return nil
+}
+
+// Save appends any unsaved events to the log and writes a snapshot, if the
+// state has a store.
+func (gs *GameState) Save() error {
+	if gs.store == nil {
+		return nil
+	}
+	err := gs.flushEvents()
+	if err != nil {
+		return err
+	}
+	return gs.saveSnapshot()
+}
+
+// flushEvents appends the events recorded since the last flush to the log.
+func (gs *GameState) flushEvents() error {
+	gs.flushMu.Lock()
+	defer gs.flushMu.Unlock()
+
+	gs.mu.Lock()
+	events := gs.unsaved
+	gs.unsaved = nil
+	gs.mu.Unlock()
+	if len(events) == 0 {
+		return nil
+	}
+
+	err := gs.store.Append(events)
+	if err != nil {
+		// Keep the events so that the next flush retries them.
+		gs.mu.Lock()
+		gs.unsaved = append(events, gs.unsaved...)
+		gs.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (gs *GameState) saveSnapshot() error {
+	snapshot := gs.Snapshot()
+	err := gs.store.Save(snapshot)
+	if err != nil {
+		return err
+	}
+	gs.mu.Lock()
+	gs.savedSeq = snapshot.Seq
+	gs.mu.Unlock()
+	return nil
+}
+
+// persist logs the events of a change and takes a snapshot every
+// snapshotEvery events, reporting rather than returning a failure so that a
+// broken store never stops the game.
+func (gs *GameState) persist() {
+	if gs.store == nil {
+		return
+	}
+	err := gs.flushEvents()
+	if err != nil {
+		fmt.Printf("failed to save game events: %v\n", err)
+		return
+	}
+
+	gs.mu.RLock()
+	due := gs.lastSeq-gs.savedSeq >= snapshotEvery
+	gs.mu.RUnlock()
+	if !due {
+		return
+	}
+	err = gs.saveSnapshot()
+	if err != nil {
+		fmt.Printf("failed to save game state: %v\n", err)
+	}
+}
@@ -0,0 +1,103 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Replay folds the event logs of several players into one timeline, printing
+// every event as it is applied. Battles are printed with the armies both
+// sides had in the location at that moment so that disputed wars can be
+// checked. Events after until are skipped unless until is zero. The state of
+// each player at the end of the replay is returned.
+func Replay(logs map[string][]Event, until time.Time) map[string]GameSnapshot {
+	states := map[string]GameSnapshot{}
+	timeline := []Event{}
+	for username, events := range logs {
+		states[username] = NewSnapshot(username)
+		timeline = append(timeline, events...)
+	}
+	sort.SliceStable(timeline, func(i, j int) bool {
+		if !timeline[i].At.Equal(timeline[j].At) {
+			return timeline[i].At.Before(timeline[j].At)
+		}
+		if timeline[i].Username != timeline[j].Username {
+			return timeline[i].Username < timeline[j].Username
+		}
+		return timeline[i].Seq < timeline[j].Seq
+	})
+
+	for _, ev := range timeline {
+		if !until.IsZero() && ev.At.After(until) {
+			break
+		}
+		state := states[ev.Username]
+		if ev.Kind == EventUnitsDestroyed {
+			printBattle(ev, states)
+		} else {
+			fmt.Printf("[%s] #%v %s: %s\n", ev.At.Format("15:04:05.000"), ev.Seq, ev.Username, describeEvent(ev))
+		}
+		state.Apply(ev)
+		states[ev.Username] = state
+	}
+	return states
+}
+
+// PrintSnapshot prints the army, resources and treaties of a player.
+func PrintSnapshot(s GameSnapshot) {
+	fmt.Printf("==== %s ====\n", s.Player.Username)
+	fmt.Printf("Resources: %v\n", s.Resources)
+	units := []Unit{}
+	for _, unit := range s.Player.Units {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].ID < units[j].ID
+	})
+	for _, unit := range units {
+		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+	}
+	for other, relation := range s.Relations {
+		fmt.Printf("* %s with %s\n", relation, other)
+	}
+}
+
+func describeEvent(ev Event) string {
+	switch ev.Kind {
+	case EventUnitSpawned:
+		return fmt.Sprintf("spawned %s %s in %s", ev.Unit.Rank, ev.Unit.Ref(), ev.Unit.Location)
+	case EventUnitMoved:
+		return fmt.Sprintf("moved %s %s to %s", ev.Unit.Rank, ev.Unit.Ref(), ev.Unit.Location)
+	case EventUnitRejected:
+		return fmt.Sprintf("spawn of %s %s rejected by the server", ev.Unit.Rank, ev.Unit.Ref())
+	case EventResourcesChanged:
+		return fmt.Sprintf("resources changed by %+d", ev.Amount)
+	case EventRelationChanged:
+		if ev.Relation == "" {
+			return fmt.Sprintf("broke treaty with %s", ev.Other)
+		}
+		return fmt.Sprintf("concluded %s with %s", ev.Relation, ev.Other)
+	}
+	return string(ev.Kind)
+}
+
+// printBattle prints the armies in the location of a destroyed-units event
+// before it is applied. The opponent's army is only known when their log is
+// part of the replay.
+func printBattle(ev Event, states map[string]GameSnapshot) {
+	fmt.Printf("[%s] #%v ---- Battle for %s: %s lost to %s ----\n", ev.At.Format("15:04:05.000"), ev.Seq, ev.Location, ev.Username, ev.Other)
+	for _, username := range []string{ev.Username, ev.Other} {
+		state, ok := states[username]
+		if !ok {
+			fmt.Printf("  %s's army is not part of the replay\n", username)
+			continue
+		}
+		units := unitsInLocation(state.Player, ev.Location)
+		fmt.Printf("  %s had power %v:", username, unitsToPowerLevel(units))
+		for _, unit := range units {
+			fmt.Printf(" %s", unit.Rank)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,48 @@
+package gamelogic
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	logs := map[string][]Event{
+		"alice": {
+			{Seq: 1, At: at, Username: "alice", Kind: EventUnitSpawned, Unit: unit("alice", 1, RankInfantry, "europe")},
+			{Seq: 2, At: at.Add(2 * time.Second), Username: "alice", Kind: EventUnitsDestroyed, Location: "europe", Other: "bob"},
+			{Seq: 3, At: at.Add(4 * time.Second), Username: "alice", Kind: EventUnitSpawned, Unit: unit("alice", 2, RankCavalry, "asia")},
+		},
+		"bob": {
+			{Seq: 1, At: at.Add(time.Second), Username: "bob", Kind: EventUnitSpawned, Unit: unit("bob", 1, RankArtillery, "europe")},
+			{Seq: 2, At: at.Add(3 * time.Second), Username: "bob", Kind: EventRelationChanged, Other: "alice", Relation: DiplomacyPeace},
+		},
+	}
+	cases := []struct {
+		name      string
+		until     time.Time
+		wantAlice []int
+		wantBob   []int
+		wantPeace bool
+	}{
+		{"whole log", time.Time{}, []int{2}, []int{1}, true},
+		{"before the battle", at.Add(time.Second), []int{1}, []int{1}, false},
+		{"after the battle", at.Add(3 * time.Second), []int{}, []int{1}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			states := Replay(logs, c.until)
+			if got := unitIDs(states["alice"].Player); !reflect.DeepEqual(got, c.wantAlice) {
+				t.Errorf("alice has units %v, want %v", got, c.wantAlice)
+			}
+			if got := unitIDs(states["bob"].Player); !reflect.DeepEqual(got, c.wantBob) {
+				t.Errorf("bob has units %v, want %v", got, c.wantBob)
+			}
+			_, peace := states["bob"].Relations["alice"]
+			if peace != c.wantPeace {
+				t.Errorf("bob at peace with alice = %v, want %v", peace, c.wantPeace)
+			}
+		})
+	}
+}
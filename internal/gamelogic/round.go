@@ -0,0 +1,150 @@
+package gamelogic
+
+import (
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// ArmyOrder is a move given during a round. Nothing moves until the round
+// ends, when the server resolves every order of the round at once.
+type ArmyOrder struct {
+	Username   string
+	Round      int
+	ToLocation Location
+	UnitIDs    []int
+}
+
+// ClaimedUsername returns the player the order claims to come from.
+func (o ArmyOrder) ClaimedUsername() string {
+	return o.Username
+}
+
+// RoundResult is sent by the server to each player concerned by the moves
+// resolved at the end of a round: the player's own moves come first, then
+// the moves of others that the player can see.
+type RoundResult struct {
+	Round int
+	Moves []ArmyMove
+}
+
+// Only the server resolves rounds.
+func (RoundResult) ServerOnly() {}
+
+func (gs *GameState) IsTurnMode() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.TurnMode
+}
+
+func (gs *GameState) GetRound() int {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.Round
+}
+
+// isRoundClosed reports whether the game is in turn mode and no round is
+// currently accepting orders.
+func (gs *GameState) isRoundClosed() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.TurnMode && !gs.roundOpen
+}
+
+// CommandOrder gives a move to be carried out when the current round ends.
+func (gs *GameState) CommandOrder(words []string) (ArmyOrder, error) {
+	newLocation, units, err := gs.parseMove(words)
+	if err != nil {
+		return ArmyOrder{}, err
+	}
+	order, err := gs.queueOrder(newLocation, units)
+	if err != nil {
+		return ArmyOrder{}, err
+	}
+	fmt.Printf("%v unit(s) will move to %s at the end of round %v\n", len(order.UnitIDs), order.ToLocation, order.Round)
+	return order, nil
+}
+
+// queueOrder records an order for the current round, refusing a second
+// order for the same unit.
+func (gs *GameState) queueOrder(newLocation Location, units []Unit) (ArmyOrder, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if !gs.roundOpen {
+		return ArmyOrder{}, fmt.Errorf("error: round %v is closed, wait for the next round to give orders", gs.Round)
+	}
+
+	ordered := map[int]struct{}{}
+	for _, o := range gs.pendingOrders {
+		for _, id := range o.UnitIDs {
+			ordered[id] = struct{}{}
+		}
+	}
+	ids := []int{}
+	for _, unit := range units {
+		if _, ok := ordered[unit.ID]; ok {
+			return ArmyOrder{}, fmt.Errorf("error: unit %v already has orders this round", unit.ID)
+		}
+		ids = append(ids, unit.ID)
+	}
+
+	order := ArmyOrder{
+		Username:   gs.Player.Username,
+		Round:      gs.Round,
+		ToLocation: newLocation,
+		UnitIDs:    ids,
+	}
+	gs.pendingOrders = append(gs.pendingOrders, order)
+	return order, nil
+}
+
+// HandleRound switches the game into turn mode and tracks the current round.
+// The orders given during a round are forgotten once it ends, since the
+// server resolves them.
+func (gs *GameState) HandleRound(rs routing.RoundState) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+
+	gs.mu.Lock()
+	gs.TurnMode = true
+	gs.Round = rs.Round
+	gs.roundOpen = rs.InProgress
+	gs.pendingOrders = nil
+	gs.mu.Unlock()
+
+	if rs.InProgress {
+		fmt.Printf("==== Round %v Started ====\n", rs.Round)
+		fmt.Printf("Give your orders before %s.\n", rs.Deadline.Format("15:04:05"))
+		return
+	}
+	fmt.Printf("==== Round %v Ended ====\n", rs.Round)
+	fmt.Println("Every order is being resolved at once.")
+}
+
+// HandleRoundResult carries out the player's own resolved moves, skipping
+// units lost since, and returns the other players' moves so that they are
+// handled like moves made in real time, against where the armies ended up.
+func (gs *GameState) HandleRoundResult(result RoundResult) []ArmyMove {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Printf("==== Round %v Resolved ====\n", result.Round)
+
+	others := []ArmyMove{}
+	for _, move := range result.Moves {
+		if move.Username != gs.GetUsername() {
+			others = append(others, move)
+			continue
+		}
+		moved := 0
+		for _, unit := range move.Units {
+			if _, ok := gs.GetUnit(unit.ID); !ok {
+				continue
+			}
+			gs.UpdateUnit(unit)
+			moved++
+		}
+		fmt.Printf("Moved %v units to %s\n", moved, move.ToLocation)
+	}
+	gs.persist()
+	return others
+}
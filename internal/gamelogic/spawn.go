@@ -5,30 +5,101 @@ import (
 	"fmt"
 )
 
-func (gs *GameState) CommandSpawn(words []string) error {
+func (gs *GameState) CommandSpawn(words []string) (UnitSpawned, error) {
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return UnitSpawned{}, errors.New("usage: spawn <location> <rank>")
+	}
+	err := gs.checkCanSpawn()
+	if err != nil {
+		return UnitSpawned{}, err
+	}
+	if gs.isRoundClosed() {
+		return UnitSpawned{}, fmt.Errorf("error: round %v is closed, wait for the next round to spawn units", gs.GetRound())
 	}
 
 	locationName := words[1]
 	locations := getAllLocations()
 	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+		return UnitSpawned{}, fmt.Errorf("error: %s is not a valid location", locationName)
 	}
 
 	rank := words[2]
 	units := getAllRanks()
 	if _, ok := units[UnitRank(rank)]; !ok {
-		return fmt.Errorf("error: %s is not a valid unit", rank)
+		return UnitSpawned{}, fmt.Errorf("error: %s is not a valid unit", rank)
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
+	cost := getRankCost()[UnitRank(rank)]
+	err = gs.spendResources(cost)
+	if err != nil {
+		return UnitSpawned{}, err
+	}
+
+	id := gs.allocateUnitID()
+	unit := Unit{
 		ID:       id,
+		Owner:    gs.GetUsername(),
 		Rank:     UnitRank(rank),
 		Location: Location(locationName),
-	})
+	}
+	gs.addUnit(unit)
 
 	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
-	return nil
+	fmt.Printf("It cost %v resources, you have %v left.\n", cost, gs.GetResources())
+	gs.persist()
+	return UnitSpawned{
+		Username: gs.GetUsername(),
+		Unit:     unit,
+	}, nil
+}
+
+// HandleSpawn reacts to another player's new unit. A unit spawned in a
+// location the local player already holds is treated like a hostile move.
+func (gs *GameState) HandleSpawn(spawn UnitSpawned) MoveOutcome {
+	defer fmt.Println("------------------------")
+	player := gs.GetPlayerSnap()
+
+	fmt.Println()
+	fmt.Println("==== Spawn Detected ====")
+	if player.Username == spawn.Username {
+		return MoveOutcomeSamePlayer
+	}
+	if !CanSeeSpawn(player, spawn) {
+		fmt.Printf("%s spawned a unit somewhere out of sight.\n", spawn.Username)
+		return MoveOutComeSafe
+	}
+	fmt.Printf("%s spawned a(n) %s in %s\n", spawn.Username, spawn.Unit.Rank, spawn.Unit.Location)
+
+	if relation, ok := gs.hasTreaty(spawn.Username); ok {
+		fmt.Printf("You have a(n) %s treaty with %s. No war will be declared.\n", relation, spawn.Username)
+		return MoveOutComeSafe
+	}
+
+	overlappingLocations := getOverlappingLocations(player, spawn.Sender())
+	if len(overlappingLocations) > 0 {
+		for _, loc := range overlappingLocations {
+			fmt.Printf("You have units in %s! You are at war with %s!\n", loc, spawn.Username)
+		}
+		return MoveOutcomeMakeWar
+	}
+	fmt.Printf("You are safe from %s's units.\n", spawn.Username)
+	return MoveOutComeSafe
+}
+
+// HandleSpawnRejection drops a unit the server refused to spawn and gives
+// back what it cost, since the server never charged for it.
+func (gs *GameState) HandleSpawnRejection(rejection SpawnRejection) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Spawn Rejected ====")
+	fmt.Printf("The server refused your %s in %s: %s\n", rejection.Unit.Rank, rejection.Unit.Location, rejection.Reason)
+
+	unit, ok := gs.GetUnit(rejection.Unit.ID)
+	if !ok || unit.Rank != rejection.Unit.Rank {
+		return
+	}
+	cost := getRankCost()[unit.Rank]
+	gs.rejectUnit(unit, cost)
+	fmt.Printf("Unit %v was removed and its %v resources refunded, you have %v.\n", unit.ID, cost, gs.GetResources())
+	gs.persist()
 }
@@ -0,0 +1,116 @@
+package gamelogic
+
+import (
+	"fmt"
+)
+
+// MoveRejectedError is returned when a unit can not legally reach the
+// requested location.
+type MoveRejectedError struct {
+	Unit   Unit
+	From   Location
+	To     Location
+	Reason string
+}
+
+func (e *MoveRejectedError) Error() string {
+	return fmt.Sprintf("error: unit %v (%s) can not move from %s to %s: %s", e.Unit.ID, e.Unit.Rank, e.From, e.To, e.Reason)
+}
+
+// getAdjacency returns the territory graph of the active map. Every edge is
+// listed in both directions.
+func getAdjacency() map[Location][]Location {
+	adjacency := map[Location][]Location{}
+	for _, t := range GetWorldMap().Territories {
+		adjacency[t.Name] = t.Adjacent
+	}
+	return adjacency
+}
+
+// getRankMoveRange returns how many hops a unit of each rank may travel in a
+// single move.
+func getRankMoveRange() map[UnitRank]int {
+	moveRange := map[UnitRank]int{}
+	for _, r := range GetWorldMap().Ranks {
+		moveRange[r.Rank] = r.MoveRange
+	}
+	return moveRange
+}
+
+// getRankPower returns the power level each rank contributes in battle.
+func getRankPower() map[UnitRank]int {
+	power := map[UnitRank]int{}
+	for _, r := range GetWorldMap().Ranks {
+		power[r.Rank] = r.Power
+	}
+	return power
+}
+
+// distance returns the number of hops between two locations, or -1 if to is
+// not reachable from from.
+func distance(from, to Location) int {
+	if from == to {
+		return 0
+	}
+	adjacency := getAdjacency()
+	visited := map[Location]struct{}{from: {}}
+	frontier := []Location{from}
+	for hops := 1; len(frontier) > 0; hops++ {
+		next := []Location{}
+		for _, loc := range frontier {
+			for _, neighbour := range adjacency[loc] {
+				if neighbour == to {
+					return hops
+				}
+				if _, ok := visited[neighbour]; ok {
+					continue
+				}
+				visited[neighbour] = struct{}{}
+				next = append(next, neighbour)
+			}
+		}
+		frontier = next
+	}
+	return -1
+}
+
+// validateUnitMove checks that unit may travel from from to to in one move.
+func validateUnitMove(unit Unit, from, to Location) error {
+	if _, ok := getAllLocations()[to]; !ok {
+		return &MoveRejectedError{Unit: unit, From: from, To: to, Reason: "unknown destination"}
+	}
+	if from == to {
+		return &MoveRejectedError{Unit: unit, From: from, To: to, Reason: "unit is already there"}
+	}
+	maxHops, ok := getRankMoveRange()[unit.Rank]
+	if !ok {
+		return &MoveRejectedError{Unit: unit, From: from, To: to, Reason: "unknown rank"}
+	}
+	hops := distance(from, to)
+	if hops < 0 {
+		return &MoveRejectedError{Unit: unit, From: from, To: to, Reason: "destination is unreachable"}
+	}
+	if hops > maxHops {
+		return &MoveRejectedError{Unit: unit, From: from, To: to, Reason: fmt.Sprintf("%d hops away, %s can move %d", hops, unit.Rank, maxHops)}
+	}
+	return nil
+}
+
+// ValidateMove checks every unit in a received move against the territory
+// graph. It returns a *MoveRejectedError for the first illegal unit.
+func ValidateMove(move ArmyMove) error {
+	for _, unit := range move.Units {
+		from, ok := move.Origins[unit.ID]
+		if !ok {
+			return &MoveRejectedError{Unit: unit, To: move.ToLocation, Reason: "origin is missing"}
+		}
+		if unit.Location != move.ToLocation {
+			return &MoveRejectedError{Unit: unit, From: from, To: move.ToLocation, Reason: "unit location does not match destination"}
+		}
+		err := validateUnitMove(unit, from, move.ToLocation)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
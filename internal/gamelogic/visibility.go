@@ -0,0 +1,35 @@
+package gamelogic
+
+// VisibleLocations returns the territories a player can see: every territory
+// they have units in and every territory adjacent to one.
+func VisibleLocations(p Player) map[Location]struct{} {
+	adjacency := getAdjacency()
+	visible := map[Location]struct{}{}
+	for _, unit := range p.Units {
+		visible[unit.Location] = struct{}{}
+		for _, neighbour := range adjacency[unit.Location] {
+			visible[neighbour] = struct{}{}
+		}
+	}
+	return visible
+}
+
+// CanSeeMove reports whether p can see either end of a move.
+func CanSeeMove(p Player, move ArmyMove) bool {
+	visible := VisibleLocations(p)
+	if _, ok := visible[move.ToLocation]; ok {
+		return true
+	}
+	for _, from := range move.Origins {
+		if _, ok := visible[from]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSeeSpawn reports whether p can see the territory a unit spawned in.
+func CanSeeSpawn(p Player, spawn UnitSpawned) bool {
+	_, ok := VisibleLocations(p)[spawn.Unit.Location]
+	return ok
+}
@@ -12,9 +12,22 @@ const (
 	WarOutcomeYouWon
 	WarOutcomeOpponentWon
 	WarOutcomeDraw
+	WarOutcomeFought
 )
 
-func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
+// WarResult is the result of the battle fought in a single contested
+// location.
+type WarResult struct {
+	Location Location
+	Outcome  WarOutcome
+	Winner   string
+	Loser    string
+}
+
+// HandleWar fights a battle in every location where the attacker and the
+// defender both have units. When at least one battle is fought it returns
+// WarOutcomeFought along with the per-location results.
+func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, results []WarResult) {
 	defer fmt.Println("------------------------")
 	fmt.Println()
 	fmt.Println("==== War Declared ====")
@@ -24,32 +37,55 @@ func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner
 
 	if player.Username == rw.Defender.Username {
 		fmt.Printf("%s, you published the war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+		return WarOutcomeNotInvolved, nil
 	}
 
 	if player.Username != rw.Attacker.Username {
 		fmt.Printf("%s, you are not involved in this war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+		return WarOutcomeNotInvolved, nil
 	}
 
-	overlappingLocation := getOverlappingLocation(rw.Attacker, rw.Defender)
-	if overlappingLocation == "" {
+	// The recognition only carries the units the attacker moved, so fight
+	// with the attacker's whole army.
+	rw.Attacker = player
+
+	overlappingLocations := getOverlappingLocations(rw.Attacker, rw.Defender)
+	if len(overlappingLocations) == 0 {
 		fmt.Printf("Error! No units are in the same location. No war will be fought.\n")
-		return WarOutcomeNoUnits, "", ""
+		return WarOutcomeNoUnits, nil
 	}
 
-	attackerUnits := []Unit{}
-	defenderUnits := []Unit{}
-	for _, unit := range rw.Attacker.Units {
-		if unit.Location == overlappingLocation {
-			attackerUnits = append(attackerUnits, unit)
-		}
+	for _, loc := range overlappingLocations {
+		results = append(results, gs.fightBattle(player, rw, loc))
 	}
-	for _, unit := range rw.Defender.Units {
-		if unit.Location == overlappingLocation {
-			defenderUnits = append(defenderUnits, unit)
+	gs.persist()
+	return WarOutcomeFought, results
+}
+
+// NewRecognitionOfWar declares war on attacker on behalf of the local player.
+// Only the defending units in contested locations are included so that the
+// rest of the army stays hidden.
+func (gs *GameState) NewRecognitionOfWar(attacker Player) RecognitionOfWar {
+	player := gs.GetPlayerSnap()
+	units := map[int]Unit{}
+	for _, loc := range getOverlappingLocations(player, attacker) {
+		for _, unit := range unitsInLocation(player, loc) {
+			units[unit.ID] = unit
 		}
 	}
+	return RecognitionOfWar{
+		Attacker: attacker,
+		Defender: Player{Username: player.Username, Units: units},
+	}
+}
+
+// fightBattle resolves the battle between the attacker and the defender in a
+// single location, removing the local player's units there if they lost.
+func (gs *GameState) fightBattle(player Player, rw RecognitionOfWar, loc Location) WarResult {
+	fmt.Printf("---- Battle for %s ----\n", loc)
+
+	attackerUnits := unitsInLocation(rw.Attacker, loc)
+	defenderUnits := unitsInLocation(rw.Defender, loc)
 
 	fmt.Printf("%s's units:\n", rw.Attacker.Username)
 	for _, unit := range attackerUnits {
@@ -64,42 +100,50 @@ func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner
 	fmt.Printf("Attacker has a power level of %v\n", attackerPower)
 	fmt.Printf("Defender has a power level of %v\n", defenderPower)
 	if attackerPower > defenderPower {
-		fmt.Printf("%s has won the war!\n", rw.Attacker.Username)
+		fmt.Printf("%s has won the war in %s!\n", rw.Attacker.Username, loc)
 		if player.Username == rw.Defender.Username {
 			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Attacker.Username, rw.Defender.Username
+			gs.removeUnitsInLocation(loc, rw.Attacker.Username)
+			fmt.Printf("Your units in %s have been killed.\n", loc)
+			return WarResult{Location: loc, Outcome: WarOutcomeOpponentWon, Winner: rw.Attacker.Username, Loser: rw.Defender.Username}
 		}
-		return WarOutcomeYouWon, rw.Attacker.Username, rw.Defender.Username
+		return WarResult{Location: loc, Outcome: WarOutcomeYouWon, Winner: rw.Attacker.Username, Loser: rw.Defender.Username}
 	} else if defenderPower > attackerPower {
-		fmt.Printf("%s has won the war!\n", rw.Defender.Username)
+		fmt.Printf("%s has won the war in %s!\n", rw.Defender.Username, loc)
 		if player.Username == rw.Attacker.Username {
 			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Defender.Username, rw.Attacker.Username
+			gs.removeUnitsInLocation(loc, rw.Defender.Username)
+			fmt.Printf("Your units in %s have been killed.\n", loc)
+			return WarResult{Location: loc, Outcome: WarOutcomeOpponentWon, Winner: rw.Defender.Username, Loser: rw.Attacker.Username}
+		}
+		return WarResult{Location: loc, Outcome: WarOutcomeYouWon, Winner: rw.Defender.Username, Loser: rw.Attacker.Username}
+	}
+	fmt.Printf("The war in %s ended in a draw!\n", loc)
+	fmt.Printf("Your units in %s have been killed.\n", loc)
+	opponent := rw.Defender.Username
+	if player.Username == rw.Defender.Username {
+		opponent = rw.Attacker.Username
+	}
+	gs.removeUnitsInLocation(loc, opponent)
+	return WarResult{Location: loc, Outcome: WarOutcomeDraw, Winner: rw.Attacker.Username, Loser: rw.Defender.Username}
+}
+
+// unitsInLocation returns the player's units in loc.
+func unitsInLocation(p Player, loc Location) []Unit {
+	units := []Unit{}
+	for _, unit := range p.Units {
+		if unit.Location == loc {
+			units = append(units, unit)
 		}
-		return WarOutcomeYouWon, rw.Defender.Username, rw.Attacker.Username
 	}
-	fmt.Println("The war ended in a draw!")
-	fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-	gs.removeUnitsInLocation(overlappingLocation)
-	return WarOutcomeDraw, rw.Attacker.Username, rw.Defender.Username
+	return units
 }
 
 func unitsToPowerLevel(units []Unit) int {
+	rankPower := getRankPower()
 	power := 0
 	for _, unit := range units {
-		if unit.Rank == RankArtillery {
-			power += 10
-		}
-		if unit.Rank == RankCavalry {
-			power += 5
-		}
-		if unit.Rank == RankInfantry {
-			power += 1
-		}
+		power += rankPower[unit.Rank]
 	}
 	return power
 }
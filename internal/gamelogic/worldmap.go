@@ -0,0 +1,198 @@
+package gamelogic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// WorldMap describes the territories of a game and the unit ranks that can be
+// spawned on it.
+type WorldMap struct {
+	Name              string      `json:"name"`
+	StartingResources int         `json:"startingResources"`
+	Territories       []Territory `json:"territories"`
+	Ranks             []RankStats `json:"ranks"`
+}
+
+type Territory struct {
+	Name     Location   `json:"name"`
+	Terrain  string     `json:"terrain"`
+	Income   int        `json:"income"`
+	Adjacent []Location `json:"adjacent"`
+}
+
+type RankStats struct {
+	Rank      UnitRank `json:"rank"`
+	Power     int      `json:"power"`
+	MoveRange int      `json:"moveRange"`
+	Cost      int      `json:"cost"`
+}
+
+var (
+	worldMapMu     = &sync.RWMutex{}
+	activeWorldMap = DefaultWorldMap()
+)
+
+// DefaultWorldMap returns the built-in map used when no map file is given.
+func DefaultWorldMap() WorldMap {
+	m := WorldMap{
+		Name:              "earth",
+		StartingResources: 20,
+		Territories: []Territory{
+			{Name: "americas", Terrain: "plains", Income: 3, Adjacent: []Location{"europe", "africa", "asia", "antarctica"}},
+			{Name: "europe", Terrain: "hills", Income: 3, Adjacent: []Location{"americas", "africa", "asia"}},
+			{Name: "africa", Terrain: "desert", Income: 2, Adjacent: []Location{"americas", "europe", "asia", "antarctica"}},
+			{Name: "asia", Terrain: "mountains", Income: 3, Adjacent: []Location{"americas", "europe", "africa", "australia"}},
+			{Name: "australia", Terrain: "desert", Income: 2, Adjacent: []Location{"asia", "antarctica"}},
+			{Name: "antarctica", Terrain: "ice", Income: 1, Adjacent: []Location{"americas", "africa", "australia"}},
+		},
+		Ranks: []RankStats{
+			{Rank: RankInfantry, Power: 1, MoveRange: 1, Cost: 1},
+			{Rank: RankCavalry, Power: 5, MoveRange: 2, Cost: 6},
+			{Rank: RankArtillery, Power: 10, MoveRange: 1, Cost: 12},
+		},
+	}
+	m.normalize()
+	return m
+}
+
+// LoadWorldMap reads and validates a JSON map definition from path.
+func LoadWorldMap(path string) (WorldMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return WorldMap{}, fmt.Errorf("could not read map file: %v", err)
+	}
+
+	var m WorldMap
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return WorldMap{}, fmt.Errorf("could not parse map file: %v", err)
+	}
+
+	err = m.validate()
+	if err != nil {
+		return WorldMap{}, err
+	}
+	m.normalize()
+	return m, nil
+}
+
+// SetWorldMap makes m the map used for location, rank and movement checks.
+func SetWorldMap(m WorldMap) {
+	worldMapMu.Lock()
+	defer worldMapMu.Unlock()
+	activeWorldMap = m
+}
+
+// GetWorldMap returns the active map.
+func GetWorldMap() WorldMap {
+	worldMapMu.RLock()
+	defer worldMapMu.RUnlock()
+	return activeWorldMap
+}
+
+// Hash returns a stable digest of the map so that peers can check they are
+// playing on the same one.
+func (m WorldMap) Hash() string {
+	data, _ := json.Marshal(m)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Info returns the summary of the map that the server broadcasts.
+func (m WorldMap) Info() routing.WorldMapInfo {
+	return routing.WorldMapInfo{
+		Name: m.Name,
+		Hash: m.Hash(),
+	}
+}
+
+// CheckWorldMap compares the server's map with the active one and returns an
+// error if they differ.
+func CheckWorldMap(info routing.WorldMapInfo) error {
+	local := GetWorldMap()
+	if local.Hash() != info.Hash {
+		return fmt.Errorf("map mismatch: server is playing %s (%.12s), you loaded %s (%.12s)", info.Name, info.Hash, local.Name, local.Hash())
+	}
+	return nil
+}
+
+func (m WorldMap) validate() error {
+	if len(m.Territories) == 0 {
+		return errors.New("map has no territories")
+	}
+	if len(m.Ranks) == 0 {
+		return errors.New("map has no ranks")
+	}
+	if m.StartingResources < 0 {
+		return errors.New("map has negative starting resources")
+	}
+
+	adjacency := map[Location]map[Location]struct{}{}
+	for _, t := range m.Territories {
+		if t.Name == "" {
+			return errors.New("map has a territory without a name")
+		}
+		if _, ok := adjacency[t.Name]; ok {
+			return fmt.Errorf("territory %s is defined twice", t.Name)
+		}
+		if t.Income < 0 {
+			return fmt.Errorf("territory %s has a negative income", t.Name)
+		}
+		adjacency[t.Name] = map[Location]struct{}{}
+		for _, a := range t.Adjacent {
+			adjacency[t.Name][a] = struct{}{}
+		}
+	}
+	for from, neighbours := range adjacency {
+		for to := range neighbours {
+			if _, ok := adjacency[to]; !ok {
+				return fmt.Errorf("territory %s is adjacent to unknown territory %s", from, to)
+			}
+			if _, ok := adjacency[to][from]; !ok {
+				return fmt.Errorf("territory %s is adjacent to %s but not the other way around", from, to)
+			}
+		}
+	}
+
+	ranks := map[UnitRank]struct{}{}
+	for _, r := range m.Ranks {
+		if r.Rank == "" {
+			return errors.New("map has a rank without a name")
+		}
+		if _, ok := ranks[r.Rank]; ok {
+			return fmt.Errorf("rank %s is defined twice", r.Rank)
+		}
+		if r.MoveRange < 1 {
+			return fmt.Errorf("rank %s must be able to move at least one hop", r.Rank)
+		}
+		if r.Cost < 0 {
+			return fmt.Errorf("rank %s has a negative cost", r.Rank)
+		}
+		ranks[r.Rank] = struct{}{}
+	}
+	return nil
+}
+
+// normalize sorts the map so that equivalent definitions hash the same.
+func (m *WorldMap) normalize() {
+	sort.Slice(m.Territories, func(i, j int) bool {
+		return m.Territories[i].Name < m.Territories[j].Name
+	})
+	for _, t := range m.Territories {
+		sort.Slice(t.Adjacent, func(i, j int) bool {
+			return t.Adjacent[i] < t.Adjacent[j]
+		})
+	}
+	sort.Slice(m.Ranks, func(i, j int) bool {
+		return m.Ranks[i].Rank < m.Ranks[j].Rank
+	})
+}
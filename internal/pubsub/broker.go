@@ -0,0 +1,42 @@
+package pubsub
+
+import (
+	"net/url"
+	"os"
+)
+
+// DefaultBrokerURL is the broker used when PERIL_AMQP_URL is not set. It
+// carries no credentials: clients connect as their player, and a server
+// without credentials in its URL falls back to the broker's guest user,
+// which RabbitMQ only accepts from localhost.
+const DefaultBrokerURL = "amqp://localhost:5672/"
+
+// BrokerURLFromEnv returns the broker URL from PERIL_AMQP_URL, or
+// DefaultBrokerURL when it is not set.
+func BrokerURLFromEnv() string {
+	brokerURL := os.Getenv("PERIL_AMQP_URL")
+	if brokerURL == "" {
+		return DefaultBrokerURL
+	}
+	return brokerURL
+}
+
+// WithCredentials returns brokerURL with its user and password replaced, so
+// that each player connects to the broker as their own user.
+func WithCredentials(brokerURL, username, password string) (string, error) {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return "", err
+	}
+	u.User = url.UserPassword(username, password)
+	return u.String(), nil
+}
+
+// RedactURL hides the password in a broker URL so that it can be printed.
+func RedactURL(brokerURL string) string {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	return u.Redacted()
+}
@@ -1,9 +1,22 @@
 package pubsub
 
 import (
+	"time"
+
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// QueueLimits bounds a durable queue so that messages piling up while its
+// consumer is away can not grow it forever. Zero values mean no limit.
+type QueueLimits struct {
+	// MessageTTL is how long a message waits in the queue before it is
+	// dead-lettered.
+	MessageTTL time.Duration
+	// MaxLength is the most messages the queue holds. The oldest messages
+	// are dead-lettered to make room for new ones.
+	MaxLength int
+}
+
 // DeclareAndBind declares a queue on the provided AMQP connection and binds
 // it to the specified exchange using the given routing key. It returns the
 // opened channel and the declared queue.
@@ -42,3 +55,52 @@ func DeclareAndBind(
 
 	return channel, queue, nil
 }
+
+// DeclareAndBindLimited declares a durable queue bounded by limits and binds
+// it to the exchange with the routing key. It returns the opened channel and
+// the declared queue.
+func DeclareAndBindLimited(
+	conn *amqp.Connection,
+	exchangeName,
+	queueName,
+	key string,
+	limits QueueLimits,
+) (*amqp.Channel, amqp.Queue, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, amqp.Queue{}, err
+	}
+
+	args := amqp.Table{
+		"x-dead-letter-exchange": "peril_dlx",
+	}
+	if limits.MessageTTL > 0 {
+		args["x-message-ttl"] = limits.MessageTTL.Milliseconds()
+	}
+	if limits.MaxLength > 0 {
+		args["x-max-length"] = int64(limits.MaxLength)
+	}
+
+	queue, err := channel.QueueDeclare(queueName, true, false, false, false, args)
+	if err != nil {
+		return nil, amqp.Queue{}, err
+	}
+
+	err = channel.QueueBind(queue.Name, key, exchangeName, false, nil)
+	if err != nil {
+		return nil, amqp.Queue{}, err
+	}
+
+	return channel, queue, nil
+}
+
+// BindQueue binds an already declared queue to the exchange with an
+// additional routing key.
+func BindQueue(conn *amqp.Connection, exchangeName, queueName, key string) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+	return channel.QueueBind(queueName, key, exchangeName, false, nil)
+}
@@ -0,0 +1,44 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// DedupStore remembers the IDs of messages being handled or already
+// handled, so that a redelivered message is not handled twice. Consumers
+// sharing a store never handle the same message twice between them.
+type DedupStore interface {
+	// Claim atomically records id and reports whether it was new. Only the
+	// consumer that claimed an ID handles its message.
+	Claim(id string) (bool, error)
+	// Release forgets a claim whose message was not handled.
+	Release(id string) error
+}
+
+// newMessageID returns a random ID for a published message.
+func newMessageID() string {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+type messageIDKey struct{}
+
+// contextWithMessageID returns a copy of ctx carrying the ID of the message
+// being handled.
+func contextWithMessageID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, messageIDKey{}, id)
+}
+
+// MessageIDFromContext returns the ID of the message a handler was called
+// with. The ID is the same on every redelivery of a message, so a handler
+// can tell a redelivery from a new message with the same content.
+func MessageIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey{}).(string)
+	return id
+}
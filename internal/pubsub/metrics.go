@@ -0,0 +1,212 @@
+package pubsub
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the handler latency
+// histogram buckets.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// queueStats counts what happened to the deliveries of one queue.
+type queueStats struct {
+	delivered      uint64
+	acked          uint64
+	nackRequeue    uint64
+	nackDiscard    uint64
+	decodeFailures uint64
+	rejected       uint64
+	// latencyCounts holds a count per bucket plus one for +Inf.
+	latencyCounts []uint64
+	latencySum    float64
+	latencyCount  uint64
+}
+
+// exchangeStats counts the messages published to one exchange.
+type exchangeStats struct {
+	published uint64
+	errors    uint64
+}
+
+var (
+	metricsMu       = &sync.Mutex{}
+	queueMetrics    = map[string]*queueStats{}
+	exchangeMetrics = map[string]*exchangeStats{}
+)
+
+// queueStatsFor returns the stats of queue. The caller must hold metricsMu.
+func queueStatsFor(queue string) *queueStats {
+	s, ok := queueMetrics[queue]
+	if !ok {
+		s = &queueStats{latencyCounts: make([]uint64, len(latencyBuckets)+1)}
+		queueMetrics[queue] = s
+	}
+	return s
+}
+
+// recordDelivered counts a delivery received from queue.
+func recordDelivered(queue string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	queueStatsFor(queue).delivered++
+}
+
+// recordDecodeFailure counts a delivery from queue whose body could not be
+// decoded.
+func recordDecodeFailure(queue string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	queueStatsFor(queue).decodeFailures++
+}
+
+// recordRejected counts a delivery from queue that failed the message check.
+func recordRejected(queue string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	queueStatsFor(queue).rejected++
+}
+
+// recordHandled counts how a handler settled a delivery from queue and how
+// long it took since start.
+func recordHandled(queue string, acktype AckType, start time.Time) {
+	seconds := time.Since(start).Seconds()
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	s := queueStatsFor(queue)
+	switch acktype {
+	case Ack:
+		s.acked++
+	case NackRequeue:
+		s.nackRequeue++
+	case NackDiscard:
+		s.nackDiscard++
+	}
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	s.latencyCounts[i]++
+	s.latencySum += seconds
+	s.latencyCount++
+}
+
+// recordPublish counts a message published to exchange, and whether it
+// failed.
+func recordPublish(exchange string, err error) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	s, ok := exchangeMetrics[exchange]
+	if !ok {
+		s = &exchangeStats{}
+		exchangeMetrics[exchange] = s
+	}
+	s.published++
+	if err != nil {
+		s.errors++
+	}
+}
+
+// WriteMetrics writes every counter and histogram in the Prometheus text
+// exposition format.
+func WriteMetrics(w io.Writer) error {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	var sb strings.Builder
+	queues := sortedKeys(queueMetrics)
+	counters := []struct {
+		name  string
+		help  string
+		value func(*queueStats) uint64
+	}{
+		{"peril_messages_delivered_total", "Deliveries received per queue.", func(s *queueStats) uint64 { return s.delivered }},
+		{"peril_messages_acked_total", "Deliveries acknowledged per queue.", func(s *queueStats) uint64 { return s.acked }},
+		{"peril_messages_nack_requeue_total", "Deliveries nacked and requeued per queue.", func(s *queueStats) uint64 { return s.nackRequeue }},
+		{"peril_messages_nack_discard_total", "Deliveries nacked and discarded per queue.", func(s *queueStats) uint64 { return s.nackDiscard }},
+		{"peril_messages_decode_failures_total", "Deliveries whose body could not be decoded per queue.", func(s *queueStats) uint64 { return s.decodeFailures }},
+		{"peril_messages_rejected_total", "Deliveries dead-lettered by the message check per queue.", func(s *queueStats) uint64 { return s.rejected }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for _, queue := range queues {
+			fmt.Fprintf(&sb, "%s{queue=%s} %d\n", c.name, labelValue(queue), c.value(queueMetrics[queue]))
+		}
+	}
+
+	name := "peril_handler_duration_seconds"
+	fmt.Fprintf(&sb, "# HELP %s Time from delivery until the handler settled it per queue.\n# TYPE %s histogram\n", name, name)
+	for _, queue := range queues {
+		s := queueMetrics[queue]
+		label := labelValue(queue)
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += s.latencyCounts[i]
+			fmt.Fprintf(&sb, "%s_bucket{queue=%s,le=\"%g\"} %d\n", name, label, bound, cumulative)
+		}
+		fmt.Fprintf(&sb, "%s_bucket{queue=%s,le=\"+Inf\"} %d\n", name, label, s.latencyCount)
+		fmt.Fprintf(&sb, "%s_sum{queue=%s} %g\n", name, label, s.latencySum)
+		fmt.Fprintf(&sb, "%s_count{queue=%s} %d\n", name, label, s.latencyCount)
+	}
+
+	exchanges := sortedKeys(exchangeMetrics)
+	fmt.Fprintf(&sb, "# HELP peril_published_total Messages published per exchange.\n# TYPE peril_published_total counter\n")
+	for _, exchange := range exchanges {
+		fmt.Fprintf(&sb, "peril_published_total{exchange=%s} %d\n", labelValue(exchange), exchangeMetrics[exchange].published)
+	}
+	fmt.Fprintf(&sb, "# HELP peril_publish_errors_total Failed publishes per exchange.\n# TYPE peril_publish_errors_total counter\n")
+	for _, exchange := range exchanges {
+		fmt.Fprintf(&sb, "peril_publish_errors_total{exchange=%s} %d\n", labelValue(exchange), exchangeMetrics[exchange].errors)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// MetricsHandler serves WriteMetrics over HTTP.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteMetrics(w)
+	})
+}
+
+// ServeMetrics listens on addr and serves MetricsHandler at /metrics in the
+// background. It only returns once the address is bound, so that a port
+// already in use is reported.
+func ServeMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+	go func() {
+		err := http.Serve(listener, mux)
+		if err != nil {
+			fmt.Printf("metrics endpoint stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// labelValue quotes v as a label value, escaping what the format requires.
+func labelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return `"` + v + `"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -12,6 +12,12 @@ import (
 // using the provided AMQP channel. The publish is performed with a background
 // context.
 func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
+	return PublishGobContext(context.Background(), ch, exchange, key, val)
+}
+
+// PublishGobContext is PublishGob with the trace of ctx continued by the
+// message, so that its consumer is part of that trace.
+func PublishGobContext[T any](ctx context.Context, ch *amqp.Channel, exchange, key string, val T) error {
 
 	// Encode the value to Gob.
 	var buf bytes.Buffer
@@ -22,12 +28,11 @@ func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
 	}
 
 	// Build the AMQP publishing message.
-	publishVal := amqp.Publishing{
-		ContentType: "application/gob",
-		Body:        buf.Bytes(),
-	}
+	publishVal, span := newPublishing(ctx, exchange, key, "application/gob", buf.Bytes())
+	defer span.End()
 
 	// Publish the message to the exchange with the routing key.
-	err = ch.PublishWithContext(context.Background(), exchange, key, false, false, publishVal)
+	err = ch.PublishWithContext(ctx, exchange, key, false, false, publishVal)
+	recordPublish(exchange, err)
 	return err
 }
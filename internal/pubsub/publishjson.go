@@ -11,6 +11,12 @@ import (
 // using the provided AMQP channel. The publish is performed with a background
 // context.
 func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
+	return PublishJSONContext(context.Background(), ch, exchange, key, val)
+}
+
+// PublishJSONContext is PublishJSON with the trace of ctx continued by the
+// message, so that its consumer is part of that trace.
+func PublishJSONContext[T any](ctx context.Context, ch *amqp.Channel, exchange, key string, val T) error {
 
 	// Marshal the value to JSON.
 	jsonVal, err := json.Marshal(val)
@@ -19,12 +25,11 @@ func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
 	}
 
 	// Build the AMQP publishing message.
-	publishVal := amqp.Publishing{
-		ContentType: "application/json",
-		Body:        jsonVal,
-	}
+	publishVal, span := newPublishing(ctx, exchange, key, "application/json", jsonVal)
+	defer span.End()
 
 	// Publish the message to the exchange with the routing key.
-	err = ch.PublishWithContext(context.Background(), exchange, key, false, false, publishVal)
+	err = ch.PublishWithContext(ctx, exchange, key, false, false, publishVal)
+	recordPublish(exchange, err)
 	return err
 }
@@ -0,0 +1,147 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// replyQueue is RabbitMQ's direct reply-to pseudo queue, which delivers
+// replies straight to the consumer that made the request.
+const replyQueue = "amq.rabbitmq.reply-to"
+
+// CallJSON publishes req to the given exchange/key and waits up to timeout
+// for the JSON reply of a ServeJSON handler. The request carries userID,
+// which the broker rejects unless it is the user conn is logged in as.
+func CallJSON[Req, Resp any](
+	conn *amqp.Connection,
+	exchangeName,
+	key,
+	userID string,
+	req Req,
+	timeout time.Duration,
+) (Resp, error) {
+	var resp Resp
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return resp, err
+	}
+	defer channel.Close()
+
+	// Direct reply-to requires consuming in auto-ack mode before
+	// publishing.
+	replies, err := channel.Consume(replyQueue, "", true, true, false, false, nil)
+	if err != nil {
+		return resp, err
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		return resp, err
+	}
+	correlationID := hex.EncodeToString(id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = channel.PublishWithContext(ctx, exchangeName, key, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: correlationID,
+		ReplyTo:       replyQueue,
+		UserId:        userID,
+		Body:          body,
+	})
+	if err != nil {
+		return resp, err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return resp, errors.New("timed out waiting for a reply")
+		case delivery, ok := <-replies:
+			if !ok {
+				return resp, errors.New("reply channel closed")
+			}
+			if delivery.CorrelationId != correlationID {
+				continue
+			}
+			err = json.Unmarshal(delivery.Body, &resp)
+			if err != nil {
+				return resp, fmt.Errorf("failed to unmarshal reply: %v", err)
+			}
+			return resp, nil
+		}
+	}
+}
+
+// ServeJSON sets up a consumer on a durable queue that answers each JSON
+// request from the given exchange/key with the JSON reply of handler. The
+// handler is also given the request's user ID, which the broker has checked
+// is the user that published it, or an empty string when it was not set.
+func ServeJSON[Req, Resp any](
+	conn *amqp.Connection,
+	exchangeName,
+	queueName,
+	key string,
+	handler func(string, Req) Resp,
+) error {
+
+	// Declare the queue and bind it to the exchange with the routing key.
+	channel, queue, err := DeclareAndBind(conn, exchangeName, queueName, key, Durable)
+	if err != nil {
+		return err
+	}
+
+	// Start consuming requests from the queue.
+	deliveries, err := channel.Consume(queue.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	go serveRequests(channel, deliveries, handler)
+	return nil
+}
+
+// serveRequests replies to every request on the channel it came from. A
+// request that can not be decoded or answered is discarded.
+func serveRequests[Req, Resp any](channel *amqp.Channel, deliveries <-chan amqp.Delivery, handler func(string, Req) Resp) {
+	for delivery := range deliveries {
+		var req Req
+		err := json.Unmarshal(delivery.Body, &req)
+		if err != nil || delivery.ReplyTo == "" {
+			fmt.Printf("discarding malformed request: %v\n", err)
+			delivery.Nack(false, false)
+			continue
+		}
+
+		body, err := json.Marshal(handler(delivery.UserId, req))
+		if err != nil {
+			fmt.Printf("failed to marshal reply: %v\n", err)
+			delivery.Nack(false, false)
+			continue
+		}
+		err = channel.PublishWithContext(context.Background(), "", delivery.ReplyTo, false, false, amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: delivery.CorrelationId,
+			Body:          body,
+		})
+		if err != nil {
+			fmt.Printf("failed to publish reply: %v\n", err)
+			delivery.Nack(false, false)
+			continue
+		}
+		delivery.Ack(false)
+	}
+}
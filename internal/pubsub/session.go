@@ -0,0 +1,162 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// TokenHeader carries the publisher's session token.
+	TokenHeader = "x-peril-token"
+	// SignatureHeader carries the publisher's signature of the routing key
+	// and body.
+	SignatureHeader = "x-peril-signature"
+	// RejectReasonHeader tells why a subscriber dead-lettered a message.
+	RejectReasonHeader = "x-peril-reject-reason"
+)
+
+// deadLetterExchange receives the messages subscribers reject.
+const deadLetterExchange = "peril_dlx"
+
+// Claimant is implemented by messages that claim to come from a player.
+type Claimant interface {
+	ClaimedUsername() string
+}
+
+// ServerOnly is implemented by messages that only a server may publish,
+// such as pauses, ticks and match events.
+type ServerOnly interface {
+	ServerOnly()
+}
+
+// Envelope is what a subscriber checks before handing a message to its
+// handler.
+type Envelope struct {
+	Token     string
+	Signature []byte
+	// Signed is the data the signature covers.
+	Signed []byte
+	// Claimed is the player the message claims to come from, or empty when
+	// it makes no claim.
+	Claimed string
+	// ServerOnly is set for messages that must be signed by a server's
+	// session.
+	ServerOnly bool
+}
+
+var (
+	sessionMu    = &sync.RWMutex{}
+	sessionToken string
+	signingKey   ed25519.PrivateKey
+	messageCheck func(Envelope) error
+)
+
+// SetSession sets the token attached to every message published from now
+// on and the key that signs them. The token must vouch for the key's public
+// half.
+func SetSession(token string, key ed25519.PrivateKey) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	sessionToken = token
+	signingKey = key
+}
+
+// SetMessageCheck sets the check run on every consumed message. Messages it
+// rejects are dead-lettered before reaching their handler. Nothing is
+// checked until a check is set.
+func SetMessageCheck(check func(Envelope) error) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	messageCheck = check
+}
+
+// signedData returns the data a signature covers, so that a signed body can
+// not be replayed under another routing key, message ID or trace.
+func signedData(key, messageID, traceparent string, body []byte) []byte {
+	data := make([]byte, 0, len(key)+len(messageID)+len(traceparent)+3+len(body))
+	data = append(data, key...)
+	data = append(data, '\n')
+	data = append(data, messageID...)
+	data = append(data, '\n')
+	data = append(data, traceparent...)
+	data = append(data, '\n')
+	return append(data, body...)
+}
+
+// signHeaders adds the session headers to the headers of a message
+// published with key, messageID and body. The signature covers the
+// traceparent already in headers, if any.
+func signHeaders(headers amqp.Table, key, messageID string, body []byte) {
+	sessionMu.RLock()
+	defer sessionMu.RUnlock()
+	if sessionToken == "" {
+		return
+	}
+	headers[TokenHeader] = sessionToken
+	if signingKey != nil {
+		traceparent, _ := headers[TraceparentHeader].(string)
+		headers[SignatureHeader] = ed25519.Sign(signingKey, signedData(key, messageID, traceparent, body))
+	}
+}
+
+// checkMessage runs the message check on a decoded delivery.
+func checkMessage(delivery amqp.Delivery, message any) error {
+	sessionMu.RLock()
+	check := messageCheck
+	sessionMu.RUnlock()
+	if check == nil {
+		return nil
+	}
+
+	traceparent, _ := delivery.Headers[TraceparentHeader].(string)
+	env := Envelope{
+		Signed: signedData(delivery.RoutingKey, delivery.MessageId, traceparent, delivery.Body),
+	}
+	env.Token, _ = delivery.Headers[TokenHeader].(string)
+	env.Signature, _ = delivery.Headers[SignatureHeader].([]byte)
+	if claimant, ok := message.(Claimant); ok {
+		env.Claimed = claimant.ClaimedUsername()
+	}
+	_, env.ServerOnly = message.(ServerOnly)
+	if env.Signature == nil {
+		return errors.New("missing signature")
+	}
+	return check(env)
+}
+
+// rejectMessage dead-letters a delivery with the reason it was rejected. The
+// copy is published on its own channel so that a failure can not close the
+// consumer's channel; if it fails the delivery is nacked to the queue's
+// dead-letter exchange without a reason instead.
+func rejectMessage(conn *amqp.Connection, delivery amqp.Delivery, reason error) {
+	fmt.Printf("rejecting message from %s: %v\n", delivery.RoutingKey, reason)
+
+	channel, err := conn.Channel()
+	if err != nil {
+		delivery.Nack(false, false)
+		return
+	}
+	defer channel.Close()
+
+	headers := amqp.Table{}
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	headers[RejectReasonHeader] = reason.Error()
+	err = channel.PublishWithContext(context.Background(), deadLetterExchange, delivery.RoutingKey, false, false, amqp.Publishing{
+		MessageId:   delivery.MessageId,
+		ContentType: delivery.ContentType,
+		Headers:     headers,
+		Body:        delivery.Body,
+	})
+	if err != nil {
+		delivery.Nack(false, false)
+		return
+	}
+	delivery.Ack(false)
+}
@@ -0,0 +1,175 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// SubscribeGobAsync sets up a consumer that receives Gob messages from the
+// given exchange/key and hands deserialized values of type T to handler
+// along with a function that settles the delivery. The handler may settle
+// it later, from any goroutine, which lets a batching handler acknowledge a
+// whole batch at once. Up to prefetch deliveries are unsettled at a time,
+// and the consumer span of each lasts until it is settled.
+//
+// When dedup is not nil, a message's ID is claimed before it reaches
+// handler, and a message whose ID is already claimed is acked without
+// reaching it. The claim is released when the handler does not ack the
+// message, so that it can be handled again. A consumer that crashes while
+// handling a message keeps its claim, so the message is lost rather than
+// handled twice.
+func SubscribeGobAsync[T any](
+	conn *amqp.Connection,
+	exchangeName,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	prefetch int,
+	dedup DedupStore,
+	handler func(T, func(AckType)),
+) error {
+
+	// Declare the queue and bind it to the exchange with the routing key.
+	channel, queue, err := DeclareAndBind(conn, exchangeName, queueName, key, queueType)
+	if err != nil {
+		return err
+	}
+
+	err = channel.Qos(prefetch, 0, false)
+	if err != nil {
+		return err
+	}
+
+	// Start consuming messages from the queue.
+	deliveries, err := channel.Consume(queue.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	go deliverMessageGobAsync(conn, channel, queue.Name, deliveries, dedup, handler)
+	return nil
+}
+
+// deliverMessageGobAsync reads from the AMQP deliveries channel, decodes and
+// checks each delivery body into type T and invokes handler with a settle
+// function for the delivery.
+func deliverMessageGobAsync[T any](conn *amqp.Connection, channel *amqp.Channel, queueName string, deliveries <-chan amqp.Delivery, dedup DedupStore, handler func(T, func(AckType))) {
+	acks := newAckTracker(channel)
+	for delivery := range deliveries {
+		recordDelivered(queueName)
+		var message T
+		err := gob.NewDecoder(bytes.NewReader(delivery.Body)).Decode(&message)
+		if err != nil {
+			// log the error and ACK to avoid requeues
+			recordDecodeFailure(queueName)
+			fmt.Printf("failed to decode message body: %v — acking to discard\n", err)
+			delivery.Ack(false)
+			continue
+		}
+		err = checkMessage(delivery, message)
+		if err != nil {
+			recordRejected(queueName)
+			rejectMessage(conn, delivery, err)
+			continue
+		}
+
+		start := time.Now()
+		_, span := startConsumeSpan(queueName, delivery)
+		tag := delivery.DeliveryTag
+		id := delivery.MessageId
+		acks.track(tag)
+		if dedup != nil && id != "" {
+			claimed, err := dedup.Claim(id)
+			if err != nil {
+				// Without the store, handling the message could write
+				// it twice, so try again later.
+				fmt.Printf("failed to check message %s: %v\n", id, err)
+				endConsume(span, NackRequeue)
+				recordHandled(queueName, NackRequeue, start)
+				acks.settle(tag, NackRequeue)
+				continue
+			}
+			if !claimed {
+				endConsume(span, Ack)
+				recordHandled(queueName, Ack, start)
+				acks.settle(tag, Ack)
+				continue
+			}
+		}
+
+		handler(message, func(acktype AckType) {
+			if acktype != Ack && dedup != nil && id != "" {
+				err := dedup.Release(id)
+				if err != nil {
+					fmt.Printf("failed to release message %s, it will not be handled again: %v\n", id, err)
+				}
+			}
+			endConsume(span, acktype)
+			recordHandled(queueName, acktype, start)
+			acks.settle(tag, acktype)
+		})
+	}
+}
+
+// ackTracker settles deliveries in the order they were received, so that a
+// run of acknowledged deliveries is acknowledged with a single multiple ack.
+type ackTracker struct {
+	channel *amqp.Channel
+	// pending holds the tags not yet sent to the broker, oldest first.
+	pending []uint64
+	settled map[uint64]AckType
+	mu      *sync.Mutex
+}
+
+func newAckTracker(channel *amqp.Channel) *ackTracker {
+	return &ackTracker{
+		channel: channel,
+		settled: map[uint64]AckType{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+func (t *ackTracker) track(tag uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, tag)
+}
+
+// settle records how tag was handled and sends every settled delivery at
+// the front of the queue to the broker.
+func (t *ackTracker) settle(tag uint64, acktype AckType) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.settled[tag] = acktype
+
+	var lastAck uint64
+	for len(t.pending) > 0 {
+		head := t.pending[0]
+		acktype, ok := t.settled[head]
+		if !ok {
+			break
+		}
+		t.pending = t.pending[1:]
+		delete(t.settled, head)
+
+		if acktype == Ack {
+			lastAck = head
+			continue
+		}
+		// Acknowledge the run before the nack so that the multiple ack
+		// does not cover it.
+		if lastAck != 0 {
+			t.channel.Ack(lastAck, true)
+			lastAck = 0
+		}
+		t.channel.Nack(head, false, acktype == NackRequeue)
+	}
+	if lastAck != 0 {
+		t.channel.Ack(lastAck, true)
+	}
+}
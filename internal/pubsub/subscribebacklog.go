@@ -0,0 +1,112 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// SubscribeJSONBacklog sets up a consumer on a durable queue bounded by
+// limits. Before consuming, it hands every message that waited in the queue
+// while nobody was consuming to handler, one at a time, and only returns
+// once that backlog has been caught up on. It returns the number of backlog
+// messages handled.
+func SubscribeJSONBacklog[T any](
+	conn *amqp.Connection,
+	exchangeName,
+	queueName,
+	key string,
+	limits QueueLimits,
+	handler func(T) AckType,
+) (int, error) {
+	return SubscribeJSONBacklogContext(conn, exchangeName, queueName, key, limits, ignoreContext(handler))
+}
+
+// SubscribeJSONBacklogContext is SubscribeJSONBacklog for a handler that is
+// passed the context of the delivery's consumer span.
+func SubscribeJSONBacklogContext[T any](
+	conn *amqp.Connection,
+	exchangeName,
+	queueName,
+	key string,
+	limits QueueLimits,
+	handler func(context.Context, T) AckType,
+) (int, error) {
+
+	// Declare the queue and bind it to the exchange with the routing key.
+	channel, queue, err := DeclareAndBindLimited(conn, exchangeName, queueName, key, limits)
+	if err != nil {
+		return 0, err
+	}
+
+	caughtUp, err := catchUp(conn, channel, queue.Name, handler)
+	if err != nil {
+		return caughtUp, err
+	}
+
+	//Limiting prefetch count to 10
+	err = channel.Qos(10, 0, false)
+	if err != nil {
+		return caughtUp, err
+	}
+
+	// Start consuming messages from the queue.
+	deliveries, err := channel.Consume(queue.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return caughtUp, err
+	}
+
+	// Deliver messages to the handler in a separate goroutine.
+	go deliverMessage(conn, queue.Name, deliveries, handler)
+	return caughtUp, nil
+}
+
+// catchUp pulls the messages already in the queue and hands them to handler
+// until the queue is empty. A message the handler wants requeued ends the
+// catch-up early and is left for the consumer, so that it is not pulled
+// again straight away.
+func catchUp[T any](conn *amqp.Connection, channel *amqp.Channel, queueName string, handler func(context.Context, T) AckType) (int, error) {
+	handled := 0
+	for {
+		delivery, ok, err := channel.Get(queueName, false)
+		if err != nil {
+			return handled, err
+		}
+		if !ok {
+			return handled, nil
+		}
+		recordDelivered(queueName)
+
+		var message T
+		err = json.Unmarshal(delivery.Body, &message)
+		if err != nil {
+			recordDecodeFailure(queueName)
+			fmt.Printf("failed to unmarshal message body: %v — acking to discard\n", err)
+			delivery.Ack(false)
+			continue
+		}
+		err = checkMessage(delivery, message)
+		if err != nil {
+			recordRejected(queueName)
+			rejectMessage(conn, delivery, err)
+			continue
+		}
+
+		handled++
+		start := time.Now()
+		acktype := handleTraced(queueName, delivery, message, handler)
+		recordHandled(queueName, acktype, start)
+		switch acktype {
+		case Ack:
+			delivery.Ack(false)
+		case NackDiscard:
+			delivery.Nack(false, false)
+		case NackRequeue:
+			delivery.Nack(false, true)
+			return handled, nil
+		}
+	}
+}
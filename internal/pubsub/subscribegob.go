@@ -2,8 +2,10 @@ package pubsub
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"fmt"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -23,9 +25,9 @@ func SubscribeGob[T any](
 	channel, queue, err := DeclareAndBind(conn, exchangeName, queueName, key, queueType)
 	if err != nil {
 		return err
-	} 
+	}
 
-	//Limiting prefetch count to 10 
+	//Limiting prefetch count to 10
 	err = channel.Qos(10, 0, false)
 	if err != nil {
 		return err
@@ -38,14 +40,16 @@ func SubscribeGob[T any](
 	}
 
 	// Deliver messages to the handler in a separate goroutine.
-	go deliverMessageGob(deliveries, handler)
+	go deliverMessageGob(conn, queue.Name, deliveries, ignoreContext(handler))
 	return nil
 }
 
 // deliverMessage reads from the AMQP deliveries channel, deserializes each
-// delivery body into type T, invokes handler, and acknowledges the delivery.
-func deliverMessageGob[T any](deliveries <-chan amqp.Delivery, handler func(T) AckType) {
+// delivery body into type T, checks
+// it, invokes handler within a consumer span, and acknowledges the delivery.
+func deliverMessageGob[T any](conn *amqp.Connection, queueName string, deliveries <-chan amqp.Delivery, handler func(context.Context, T) AckType) {
 	for delivery := range deliveries {
+		recordDelivered(queueName)
 		var buf bytes.Buffer
 		buf.Write(delivery.Body)
 		dec := gob.NewDecoder(&buf)
@@ -54,13 +58,25 @@ func deliverMessageGob[T any](deliveries <-chan amqp.Delivery, handler func(T) A
 		err := dec.Decode(&message)
 		if err != nil {
 			// log the error and ACK to avoid requeues
+			recordDecodeFailure(queueName)
 			fmt.Printf("failed to decode message body: %v — acking to discard\n", err)
 			delivery.Ack(false)
 			continue
 		}
 
-		acktype := handler(message)
-		
+		// Dead-letter messages that are not signed by the holder of a
+		// session for the player they claim to come from.
+		err = checkMessage(delivery, message)
+		if err != nil {
+			recordRejected(queueName)
+			rejectMessage(conn, delivery, err)
+			continue
+		}
+
+		start := time.Now()
+		acktype := handleTraced(queueName, delivery, message, handler)
+		recordHandled(queueName, acktype, start)
+
 		switch acktype {
 		case Ack:
 			delivery.Ack(false)
@@ -70,4 +86,4 @@ func deliverMessageGob[T any](deliveries <-chan amqp.Delivery, handler func(T) A
 			delivery.Nack(false, false)
 		}
 	}
-}
\ No newline at end of file
+}
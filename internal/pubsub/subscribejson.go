@@ -1,8 +1,10 @@
 package pubsub
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -17,6 +19,20 @@ func SubscribeJSON[T any](
 	queueType SimpleQueueType,
 	handler func(T) AckType,
 ) error {
+	return SubscribeJSONContext(conn, exchangeName, queueName, key, queueType, ignoreContext(handler))
+}
+
+// SubscribeJSONContext is SubscribeJSON for a handler that is passed the
+// context of the delivery's consumer span. Messages the handler publishes
+// with that context continue the delivery's trace.
+func SubscribeJSONContext[T any](
+	conn *amqp.Connection,
+	exchangeName,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	handler func(context.Context, T) AckType,
+) error {
 
 	// Declare the queue and bind it to the exchange with the routing key.
 	channel, queue, err := DeclareAndBind(conn, exchangeName, queueName, key, queueType)
@@ -37,25 +53,39 @@ func SubscribeJSON[T any](
 	}
 
 	// Deliver messages to the handler in a separate goroutine.
-	go deliverMessage(deliveries, handler)
+	go deliverMessage(conn, queue.Name, deliveries, handler)
 	return nil
 }
 
 // deliverMessage reads from the AMQP deliveries channel, unmarshals each
-// delivery body into type T, invokes handler, and acknowledges the delivery.
-func deliverMessage[T any](deliveries <-chan amqp.Delivery, handler func(T) AckType) {
+// delivery body into type T, checks
+// it, invokes handler within a consumer span, and acknowledges the delivery.
+func deliverMessage[T any](conn *amqp.Connection, queueName string, deliveries <-chan amqp.Delivery, handler func(context.Context, T) AckType) {
 	for delivery := range deliveries {
+		recordDelivered(queueName)
 		var message T
 
 		err := json.Unmarshal(delivery.Body, &message)
 		if err != nil {
 			// log the error and ACK to avoid requeues
+			recordDecodeFailure(queueName)
 			fmt.Printf("failed to unmarshal message body: %v — acking to discard\n", err)
 			delivery.Ack(false)
 			continue
 		}
 
-		acktype := handler(message)
+		// Dead-letter messages that are not signed by the holder of a
+		// session for the player they claim to come from.
+		err = checkMessage(delivery, message)
+		if err != nil {
+			recordRejected(queueName)
+			rejectMessage(conn, delivery, err)
+			continue
+		}
+
+		start := time.Now()
+		acktype := handleTraced(queueName, delivery, message, handler)
+		recordHandled(queueName, acktype, start)
 		
 		switch acktype {
 		case Ack:
@@ -67,3 +97,10 @@ func deliverMessage[T any](deliveries <-chan amqp.Delivery, handler func(T) AckT
 		}
 	}
 }
+
+// ignoreContext adapts a handler that does not need the delivery's context.
+func ignoreContext[T any](handler func(T) AckType) func(context.Context, T) AckType {
+	return func(_ context.Context, message T) AckType {
+		return handler(message)
+	}
+}
@@ -0,0 +1,136 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceparentHeader carries the W3C trace context of a message, so that a
+// message published while handling another one is part of the same trace.
+const TraceparentHeader = "traceparent"
+
+// tracerName is the instrumentation scope of the spans started here.
+const tracerName = "github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+
+// propagator carries the trace context of a message in its AMQP headers.
+var propagator = propagation.TraceContext{}
+
+// headerCarrier adapts AMQP message headers to the OpenTelemetry propagator.
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// tracer returns the tracer of the global tracer provider. Until one is set,
+// spans are not recorded, but the trace context of consumed messages is
+// still passed on to the messages published while handling them.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartTracing records every span and writes it to w as JSON, so that the
+// files of several processes can be merged and grouped by trace ID. The
+// returned function flushes the spans not yet written.
+func StartTracing(w io.Writer) (func(context.Context) error, error) {
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startPublishSpan starts the producer span of a message, continuing the
+// trace in ctx.
+func startPublishSpan(ctx context.Context, exchange, key, messageID string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "publish "+key,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitmq,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(exchange),
+			semconv.MessagingRabbitmqDestinationRoutingKey(key),
+			semconv.MessagingMessageID(messageID),
+		),
+	)
+}
+
+// startConsumeSpan starts the consumer span of a delivery from queue as a
+// child of the span that published it. A delivery without a valid
+// traceparent starts a new trace.
+func startConsumeSpan(queue string, delivery amqp.Delivery) (context.Context, trace.Span) {
+	ctx := propagator.Extract(context.Background(), headerCarrier(delivery.Headers))
+	return tracer().Start(ctx, "consume "+queue,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitmq,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(queue),
+			semconv.MessagingRabbitmqDestinationRoutingKey(delivery.RoutingKey),
+			semconv.MessagingMessageID(delivery.MessageId),
+		),
+	)
+}
+
+// endConsume records how the delivery was settled and ends the span. A
+// delivery that was not acknowledged marks the span as failed.
+func endConsume(span trace.Span, acktype AckType) {
+	span.SetAttributes(attribute.String("messaging.outcome", string(acktype)))
+	if acktype != Ack {
+		span.SetStatus(codes.Error, string(acktype))
+	}
+	span.End()
+}
+
+// handleTraced invokes handler with message within the consumer span of
+// delivery, passing it the span's context, and returns how the delivery is
+// to be settled.
+func handleTraced[T any](queueName string, delivery amqp.Delivery, message T, handler func(context.Context, T) AckType) AckType {
+	ctx, span := startConsumeSpan(queueName, delivery)
+	acktype := handler(contextWithMessageID(ctx, delivery.MessageId), message)
+	endConsume(span, acktype)
+	return acktype
+}
+
+// newPublishing builds a message carrying body under a new message ID, with
+// the trace context of its producer span and the session headers. The
+// caller ends the span once the message is published.
+func newPublishing(ctx context.Context, exchange, key, contentType string, body []byte) (amqp.Publishing, trace.Span) {
+	messageID := newMessageID()
+	ctx, span := startPublishSpan(ctx, exchange, key, messageID)
+	headers := amqp.Table{}
+	propagator.Inject(ctx, headerCarrier(headers))
+	signHeaders(headers, key, messageID, body)
+	return amqp.Publishing{
+		MessageId:   messageID,
+		ContentType: contentType,
+		Headers:     headers,
+		Body:        body,
+	}, span
+}
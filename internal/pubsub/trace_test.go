@@ -0,0 +1,139 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// deliver returns the delivery a consumer receives for a message published
+// with key.
+func deliver(key string, publishing amqp.Publishing) amqp.Delivery {
+	return amqp.Delivery{
+		RoutingKey:  key,
+		MessageId:   publishing.MessageId,
+		ContentType: publishing.ContentType,
+		Headers:     publishing.Headers,
+		Body:        publishing.Body,
+	}
+}
+
+// publish builds a message published with ctx and ends its producer span, as
+// publishing it would.
+func publish(ctx context.Context, key string) amqp.Delivery {
+	publishing, span := newPublishing(ctx, "peril_topic", key, "application/json", []byte("{}"))
+	span.End()
+	return deliver(key, publishing)
+}
+
+// recordSpans makes the global tracer provider export every span to an
+// in-memory exporter for the rest of the test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func TestTraceFollowsMoveToWarToLog(t *testing.T) {
+	exporter := recordSpans(t)
+
+	// A move makes its consumer declare war, and the war's consumer logs
+	// the outcome.
+	move := publish(context.Background(), "main.army_moves.alice")
+	handleTraced("main.army_moves_visible.bob", move, "move", func(ctx context.Context, _ string) AckType {
+		war := publish(ctx, "main.war.bob")
+		handleTraced("main.war", war, "war", func(ctx context.Context, _ string) AckType {
+			gamelog := publish(ctx, "main.game_logs.alice")
+			handleTraced("game_logs", gamelog, "log", func(context.Context, string) AckType {
+				return Ack
+			})
+			return Ack
+		})
+		return Ack
+	})
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	chain := []string{
+		"publish main.army_moves.alice",
+		"consume main.army_moves_visible.bob",
+		"publish main.war.bob",
+		"consume main.war",
+		"publish main.game_logs.alice",
+		"consume game_logs",
+	}
+	if len(spans) != len(chain) {
+		t.Fatalf("exported %d spans, want %d", len(spans), len(chain))
+	}
+	root, ok := spans[chain[0]]
+	if !ok {
+		t.Fatalf("no span %q", chain[0])
+	}
+	if root.Parent.IsValid() {
+		t.Errorf("%q has parent %s, want none", chain[0], root.Parent.SpanID())
+	}
+	for i := 1; i < len(chain); i++ {
+		parent, child := spans[chain[i-1]], spans[chain[i]]
+		if child.SpanContext.TraceID() != root.SpanContext.TraceID() {
+			t.Errorf("%q is in trace %s, want %s", chain[i], child.SpanContext.TraceID(), root.SpanContext.TraceID())
+		}
+		if child.Parent.SpanID() != parent.SpanContext.SpanID() {
+			t.Errorf("%q has parent %s, want %q (%s)", chain[i], child.Parent.SpanID(), chain[i-1], parent.SpanContext.SpanID())
+		}
+	}
+	if kind := spans[chain[1]].SpanKind; kind != trace.SpanKindConsumer {
+		t.Errorf("%q has kind %s, want %s", chain[1], kind, trace.SpanKindConsumer)
+	}
+}
+
+func TestTraceparentIsSigned(t *testing.T) {
+	recordSpans(t)
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSession("token", key)
+	defer SetSession("", nil)
+	SetMessageCheck(func(env Envelope) error {
+		if !ed25519.Verify(pub, env.Signed, env.Signature) {
+			return errors.New("bad signature")
+		}
+		return nil
+	})
+	defer SetMessageCheck(nil)
+
+	delivery := publish(context.Background(), "main.army_moves.alice")
+	err = checkMessage(delivery, struct{}{})
+	if err != nil {
+		t.Fatalf("checkMessage() = %v, want nil", err)
+	}
+
+	// Moving the message into another trace breaks its signature.
+	other := publish(context.Background(), "main.army_moves.alice")
+	headers := amqp.Table{}
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	headers[TraceparentHeader] = other.Headers[TraceparentHeader]
+	delivery.Headers = headers
+	err = checkMessage(delivery, struct{}{})
+	if err == nil {
+		t.Fatal("checkMessage() = nil for a message with a replaced traceparent")
+	}
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket allows bursts of up to capacity events and refills evenly so
+// that capacity events are allowed per period on average.
+type TokenBucket struct {
+	capacity float64
+	perToken time.Duration
+	tokens   float64
+	last     time.Time
+	mu       *sync.Mutex
+}
+
+// NewTokenBucket returns a full bucket holding capacity tokens that refills
+// completely over period.
+func NewTokenBucket(capacity int, period time.Duration) *TokenBucket {
+	return &TokenBucket{
+		capacity: float64(capacity),
+		perToken: period / time.Duration(capacity),
+		tokens:   float64(capacity),
+		last:     time.Now(),
+		mu:       &sync.Mutex{},
+	}
+}
+
+// Allow takes a token from the bucket and reports whether one was available.
+func (b *TokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += float64(now.Sub(b.last)) / float64(b.perToken)
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// KeyedLimiter keeps a separate TokenBucket for every key, such as a
+// username.
+type KeyedLimiter struct {
+	capacity int
+	period   time.Duration
+	buckets  map[string]*TokenBucket
+	mu       *sync.Mutex
+}
+
+func NewKeyedLimiter(capacity int, period time.Duration) *KeyedLimiter {
+	return &KeyedLimiter{
+		capacity: capacity,
+		period:   period,
+		buckets:  map[string]*TokenBucket{},
+		mu:       &sync.Mutex{},
+	}
+}
+
+// Allow takes a token from key's bucket and reports whether one was
+// available.
+func (l *KeyedLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewTokenBucket(l.capacity, l.period)
+		l.buckets[key] = bucket
+	}
+	l.mu.Unlock()
+	return bucket.Allow()
+}
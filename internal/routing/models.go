@@ -6,8 +6,119 @@ type PlayingState struct {
 	IsPaused bool
 }
 
+// RoundState is published by the server at the start and end of every round
+// when the game is played in turns.
+type RoundState struct {
+	Round      int
+	InProgress bool
+	Deadline   time.Time
+}
+
+// EconomyTick is published by the server on a fixed interval. Players earn
+// resources for every territory they hold on each tick.
+type EconomyTick struct {
+	Tick int
+}
+
+type MatchPhase string
+
+const (
+	MatchLobby    MatchPhase = "lobby"
+	MatchRunning  MatchPhase = "running"
+	MatchPaused   MatchPhase = "paused"
+	MatchFinished MatchPhase = "finished"
+)
+
+// MatchEvent is published by the server whenever the match changes phase.
+// Winner and Reason are only set once the match is finished.
+type MatchEvent struct {
+	Phase  MatchPhase
+	Winner string
+	Reason string
+}
+
+// ChatMessage is sent between players. To is empty for messages to
+// everyone in the room.
+type ChatMessage struct {
+	From    string
+	To      string
+	Message string
+	SentAt  time.Time
+}
+
+// ClaimedUsername returns the player the message claims to come from.
+func (m ChatMessage) ClaimedUsername() string {
+	return m.From
+}
+
 type GameLog struct {
 	CurrentTime time.Time
 	Message     string
 	Username    string
 }
+
+// ClaimedUsername returns the player the log claims to come from.
+func (gl GameLog) ClaimedUsername() string {
+	return gl.Username
+}
+
+// WorldMapInfo is broadcast by the server so that clients can check they
+// loaded the same map. Authoritative tells clients that the server enforces
+// the rules, such as spawn costs.
+type WorldMapInfo struct {
+	Name          string
+	Hash          string
+	Authoritative bool
+}
+
+// WorldMapRequest asks the server to broadcast its WorldMapInfo. Hash is the
+// hash of the map the player loaded, which the server checks against its
+// own.
+type WorldMapRequest struct {
+	Username string
+	Hash     string
+}
+
+// ClaimedUsername returns the player the request claims to come from.
+func (r WorldMapRequest) ClaimedUsername() string {
+	return r.Username
+}
+
+// LoginRequest asks the server for a session token. It carries no
+// password: the player is authenticated by the broker, which only accepts a
+// request whose user ID is the broker user it was published by. SigningKey
+// is the public key the session signs its messages with.
+type LoginRequest struct {
+	Username   string
+	SigningKey []byte
+}
+
+// LoginResponse carries the session token to attach to every message. Error
+// is set instead when the login failed.
+type LoginResponse struct {
+	Token string
+	Error string
+}
+
+// LeaderHeartbeat is published regularly by the leading server.
+type LeaderHeartbeat struct {
+	ID    string
+	Since time.Time
+}
+
+// LogBan is broadcast to every server when a player's game logs are banned
+// or the ban is lifted.
+type LogBan struct {
+	Username string
+	Banned   bool
+}
+
+// Only a server may publish these messages, so subscribers reject them when
+// they are signed by a player's session.
+func (PlayingState) ServerOnly()    {}
+func (RoundState) ServerOnly()      {}
+func (EconomyTick) ServerOnly()     {}
+func (MatchEvent) ServerOnly()      {}
+func (WorldMapInfo) ServerOnly()    {}
+func (LeaderHeartbeat) ServerOnly() {}
+func (LogBan) ServerOnly()          {}
@@ -1,16 +1,99 @@
 package routing
 
+import (
+	"fmt"
+	"regexp"
+)
+
 const (
 	ArmyMovesPrefix = "army_moves"
 
+	ArmyMovesVisiblePrefix = "army_moves_visible"
+
+	ArmySpawnsPrefix = "army_spawns"
+
+	ArmySpawnsVisiblePrefix = "army_spawns_visible"
+
+	SpawnRejectedPrefix = "spawn_rejected"
+
+	ArmyOrdersPrefix = "army_orders"
+
+	RoundResultPrefix = "round_result"
+
 	WarRecognitionsPrefix = "war"
 
+	DiplomacyPrefix = "diplomacy"
+
+	ChatPrefix = "chat"
+
+	ChatBroadcastPrefix = ChatPrefix + ".broadcast"
+
+	ChatWhisperPrefix = ChatPrefix + ".whisper"
+
 	PauseKey = "pause"
 
+	RoundKey = "round"
+
+	TickKey = "tick"
+
+	MatchKey = "match"
+
 	GameLogSlug = "game_logs"
+
+	WorldMapKey = "world_map"
+
+	WorldMapRequestPrefix = "world_map_request"
+
+	LoginKey = "login"
+
+	LeaderKey = "leader"
+
+	BanKey = "ban"
+
+	// LeaderLockQueue is the exclusive queue held by the leading server.
+	LeaderLockQueue = "peril_leader"
 )
 
 const (
 	ExchangePerilDirect = "peril_direct"
 	ExchangePerilTopic  = "peril_topic"
+	// ExchangePerilLogin only routes login requests. Players may publish to
+	// it but not bind to it, so no player can read another's request.
+	ExchangePerilLogin = "peril_login"
 )
+
+// DefaultRoom is the game room used when none is chosen.
+const DefaultRoom = "main"
+
+var (
+	roomPattern     = regexp.MustCompile(`^[a-z0-9_-]+$`)
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// RoomKey scopes a routing key or queue name to a game room so that games
+// sharing a broker never see each other's messages.
+func RoomKey(room, key string) string {
+	return room + "." + key
+}
+
+// AnyRoomKey returns a topic binding key that matches key in every room.
+func AnyRoomKey(key string) string {
+	return "*." + key
+}
+
+// ValidateRoom checks that room can be used as a single routing key word.
+func ValidateRoom(room string) error {
+	if !roomPattern.MatchString(room) {
+		return fmt.Errorf("invalid room %q: use lowercase letters, digits, '-' and '_'", room)
+	}
+	return nil
+}
+
+// ValidateUsername checks that username can be used as a single routing key
+// word, so that a player can never publish under another player's keys.
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("invalid username %q: use letters, digits, '-' and '_'", username)
+	}
+	return nil
+}
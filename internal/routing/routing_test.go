@@ -0,0 +1,144 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+)
+
+// topicMatch reports whether a message published with key reaches a queue
+// bound to a topic exchange with binding, following RabbitMQ's rules: '*'
+// matches exactly one word and '#' matches zero or more.
+func topicMatch(binding, key string) bool {
+	return matchWords(strings.Split(binding, "."), strings.Split(key, "."))
+}
+
+func matchWords(binding, key []string) bool {
+	if len(binding) == 0 {
+		return len(key) == 0
+	}
+	switch binding[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if matchWords(binding[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchWords(binding[1:], key[1:])
+	}
+	return len(key) > 0 && binding[0] == key[0] && matchWords(binding[1:], key[1:])
+}
+
+func TestTopicMatch(t *testing.T) {
+	cases := []struct {
+		binding, key string
+		want         bool
+	}{
+		{"a.*", "a.b", true},
+		{"a.*", "a.b.c", false},
+		{"a.#", "a", true},
+		{"a.#", "a.b.c", true},
+		{"*.a", "b.a", true},
+		{"*.a", "a", false},
+	}
+	for _, c := range cases {
+		if got := topicMatch(c.binding, c.key); got != c.want {
+			t.Errorf("topicMatch(%q, %q) = %v, want %v", c.binding, c.key, got, c.want)
+		}
+	}
+}
+
+// roomBindings are the binding keys the server and client use inside a room,
+// paired with a key a player publishes that the binding is meant to match.
+var roomBindings = []struct {
+	binding string
+	publish string
+}{
+	{ArmyMovesPrefix + ".*", ArmyMovesPrefix + ".alice"},
+	{ArmyMovesVisiblePrefix + ".alice", ArmyMovesVisiblePrefix + ".alice"},
+	{ArmySpawnsPrefix + ".*", ArmySpawnsPrefix + ".alice"},
+	{ArmySpawnsVisiblePrefix + ".alice", ArmySpawnsVisiblePrefix + ".alice"},
+	{ArmyOrdersPrefix + ".*", ArmyOrdersPrefix + ".alice"},
+	{RoundResultPrefix + ".alice", RoundResultPrefix + ".alice"},
+	{WarRecognitionsPrefix + ".*", WarRecognitionsPrefix + ".alice"},
+	{DiplomacyPrefix + ".bob", DiplomacyPrefix + ".bob"},
+	{ChatPrefix + ".#", ChatBroadcastPrefix + ".alice"},
+	{ChatBroadcastPrefix + ".*", ChatBroadcastPrefix + ".alice"},
+	{ChatWhisperPrefix + ".bob", ChatWhisperPrefix + ".bob"},
+	{GameLogSlug + ".*", GameLogSlug + ".alice"},
+	{WorldMapRequestPrefix + ".*", WorldMapRequestPrefix + ".alice"},
+	{PauseKey, PauseKey},
+	{RoundKey, RoundKey},
+	{TickKey, TickKey},
+	{MatchKey, MatchKey},
+	{WorldMapKey, WorldMapKey},
+}
+
+func TestRoomKeysNeverCrossRooms(t *testing.T) {
+	rooms := []string{DefaultRoom, "other", "main-2", "main_b", "a"}
+	for _, rb := range roomBindings {
+		for _, bindingRoom := range rooms {
+			binding := RoomKey(bindingRoom, rb.binding)
+			for _, publishRoom := range rooms {
+				key := RoomKey(publishRoom, rb.publish)
+				got := topicMatch(binding, key)
+				want := bindingRoom == publishRoom
+				if got != want {
+					t.Errorf("binding %q matches %q = %v, want %v", binding, key, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestAnyRoomKeyMatchesEveryRoom(t *testing.T) {
+	binding := AnyRoomKey(GameLogSlug + ".*")
+	for _, room := range []string{DefaultRoom, "other"} {
+		key := RoomKey(room, GameLogSlug+".alice")
+		if !topicMatch(binding, key) {
+			t.Errorf("binding %q does not match %q", binding, key)
+		}
+	}
+}
+
+func TestRoomQueueNamesAreDistinct(t *testing.T) {
+	queues := []string{
+		ArmyMovesPrefix,
+		ArmySpawnsPrefix,
+		ChatPrefix,
+		WorldMapRequestPrefix,
+		MatchKey + "." + WarRecognitionsPrefix,
+		ArmyMovesVisiblePrefix + ".alice",
+		ArmyMovesVisiblePrefix + ".durable.alice",
+		ArmySpawnsVisiblePrefix + ".alice",
+		ArmyOrdersPrefix,
+		RoundResultPrefix + ".alice",
+		PauseKey + ".alice",
+	}
+	seen := map[string]string{}
+	for _, room := range []string{DefaultRoom, "other"} {
+		for _, queue := range queues {
+			name := RoomKey(room, queue)
+			if prev, ok := seen[name]; ok {
+				t.Errorf("queue %q of room %s is also used by room %s", name, room, prev)
+			}
+			seen[name] = room
+		}
+	}
+}
+
+// Room names must be a single routing key word, or a room could spell out
+// another room's keys, such as room "main.army_moves" publishing into "main".
+func TestValidateRoom(t *testing.T) {
+	for _, room := range []string{DefaultRoom, "room-2", "room_b", "0"} {
+		if err := ValidateRoom(room); err != nil {
+			t.Errorf("ValidateRoom(%q) = %v, want nil", room, err)
+		}
+	}
+	for _, room := range []string{"", "a.b", "*", "#", "main.army_moves", "Main", "a b"} {
+		if err := ValidateRoom(room); err == nil {
+			t.Errorf("ValidateRoom(%q) = nil, want an error", room)
+		}
+	}
+}
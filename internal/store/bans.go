@@ -0,0 +1,78 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// BanStore records banned players in a SQLite database, so that bans
+// survive restarts and can be shared by servers.
+type BanStore struct {
+	db *sql.DB
+}
+
+// NewBanStore opens (or creates) the database at path.
+func NewBanStore(path string) (*BanStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("could not open ban database: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS banned_players (
+		username  TEXT PRIMARY KEY,
+		banned_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create ban table: %v", err)
+	}
+	return &BanStore{
+		db: db,
+	}, nil
+}
+
+// Ban records username as banned. Banning a banned player does nothing.
+func (s *BanStore) Ban(username string) error {
+	_, err := s.db.Exec(
+		`INSERT OR IGNORE INTO banned_players (username, banned_at) VALUES (?, ?)`,
+		username, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("could not ban player: %v", err)
+	}
+	return nil
+}
+
+func (s *BanStore) Unban(username string) error {
+	_, err := s.db.Exec(`DELETE FROM banned_players WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("could not unban player: %v", err)
+	}
+	return nil
+}
+
+// Banned returns every banned player.
+func (s *BanStore) Banned() ([]string, error) {
+	rows, err := s.db.Query(`SELECT username FROM banned_players ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("could not list banned players: %v", err)
+	}
+	defer rows.Close()
+
+	usernames := []string{}
+	for rows.Next() {
+		var username string
+		err := rows.Scan(&username)
+		if err != nil {
+			return nil, fmt.Errorf("could not list banned players: %v", err)
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+func (s *BanStore) Close() error {
+	return s.db.Close()
+}
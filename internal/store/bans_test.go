@@ -0,0 +1,39 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBanStoreSurvivesReopening(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.db")
+	s, err := NewBanStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"mallory", "eve", "mallory"} {
+		err := s.Ban(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = s.Unban("eve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = NewBanStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	banned, err := s.Banned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"mallory"}; !reflect.DeepEqual(banned, want) {
+		t.Fatalf("Banned() = %v, want %v", banned, want)
+	}
+}
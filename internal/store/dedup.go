@@ -0,0 +1,73 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DedupStore records claimed message IDs in a SQLite database. Servers
+// sharing the database never handle the same message twice between them.
+type DedupStore struct {
+	db *sql.DB
+}
+
+// NewDedupStore opens (or creates) the database at path.
+func NewDedupStore(path string) (*DedupStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("could not open dedup database: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS handled_messages (
+		id         TEXT PRIMARY KEY,
+		handled_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create dedup table: %v", err)
+	}
+	return &DedupStore{
+		db: db,
+	}, nil
+}
+
+// Claim inserts id, relying on its primary key so that of several servers
+// claiming the same message at once only one succeeds.
+func (s *DedupStore) Claim(id string) (bool, error) {
+	res, err := s.db.Exec(
+		`INSERT OR IGNORE INTO handled_messages (id, handled_at) VALUES (?, ?)`,
+		id, time.Now().UTC(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("could not claim message: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not claim message: %v", err)
+	}
+	return n == 1, nil
+}
+
+func (s *DedupStore) Release(id string) error {
+	_, err := s.db.Exec(`DELETE FROM handled_messages WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("could not release message: %v", err)
+	}
+	return nil
+}
+
+// Prune forgets the messages handled before t. They can no longer be
+// redelivered, so there is no need to remember them.
+func (s *DedupStore) Prune(t time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM handled_messages WHERE handled_at < ?`, t.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("could not prune handled messages: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *DedupStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDedupStoreClaimsOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.db")
+	stores := []*DedupStore{}
+	for i := 0; i < 4; i++ {
+		s, err := NewDedupStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		stores = append(stores, s)
+	}
+
+	// Servers sharing the database race to claim the same message.
+	wins := make(chan bool, len(stores))
+	wg := &sync.WaitGroup{}
+	for _, s := range stores {
+		wg.Add(1)
+		go func(s *DedupStore) {
+			defer wg.Done()
+			claimed, err := s.Claim("msg-1")
+			if err != nil {
+				t.Error(err)
+			}
+			wins <- claimed
+		}(s)
+	}
+	wg.Wait()
+	close(wins)
+	n := 0
+	for claimed := range wins {
+		if claimed {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Fatalf("%d stores claimed the message, want 1", n)
+	}
+
+	// A released message can be claimed again.
+	err := stores[0].Release("msg-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := stores[1].Claim("msg-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed {
+		t.Fatal("released message could not be claimed again")
+	}
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+type FileFormat string
+
+const (
+	FormatJSON FileFormat = "json"
+	FormatGob  FileFormat = "gob"
+)
+
+// FileStore keeps one snapshot file and one event log per username in a
+// directory. Event logs are always JSON Lines so that they can be appended
+// to and read with standard tools, whatever the snapshot format.
+type FileStore struct {
+	dir    string
+	format FileFormat
+}
+
+// NewFileStore returns a store writing snapshots in format to dir, creating
+// the directory if needed.
+func NewFileStore(dir string, format FileFormat) (*FileStore, error) {
+	if format != FormatJSON && format != FormatGob {
+		return nil, fmt.Errorf("unknown snapshot format %q", format)
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create state directory: %v", err)
+	}
+	return &FileStore{
+		dir:    dir,
+		format: format,
+	}, nil
+}
+
+func (s *FileStore) path(username string) string {
+	return filepath.Join(s.dir, username+"."+string(s.format))
+}
+
+func (s *FileStore) eventsPath(username string) string {
+	return filepath.Join(s.dir, username+".events.jsonl")
+}
+
+func (s *FileStore) Load(username string) (gamelogic.GameSnapshot, bool, error) {
+	data, err := os.ReadFile(s.path(username))
+	if errors.Is(err, os.ErrNotExist) {
+		return gamelogic.GameSnapshot{}, false, nil
+	}
+	if err != nil {
+		return gamelogic.GameSnapshot{}, false, fmt.Errorf("could not read snapshot: %v", err)
+	}
+
+	var snapshot gamelogic.GameSnapshot
+	if s.format == FormatGob {
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot)
+	} else {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	if err != nil {
+		return gamelogic.GameSnapshot{}, false, fmt.Errorf("could not decode snapshot: %v", err)
+	}
+	return snapshot, true, nil
+}
+
+// Save writes the snapshot to a temporary file and renames it into place so
+// that a crash never leaves a half-written snapshot behind.
+func (s *FileStore) Save(snapshot gamelogic.GameSnapshot) error {
+	var buf bytes.Buffer
+	var err error
+	if s.format == FormatGob {
+		err = gob.NewEncoder(&buf).Encode(snapshot)
+	} else {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(snapshot)
+	}
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %v", err)
+	}
+
+	path := s.path(snapshot.Player.Username)
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	return nil
+}
+
+// Append writes each event as a line of its player's log and syncs the file
+// before returning.
+func (s *FileStore) Append(events []gamelogic.Event) error {
+	byUser := map[string][]gamelogic.Event{}
+	order := []string{}
+	for _, ev := range events {
+		if _, ok := byUser[ev.Username]; !ok {
+			order = append(order, ev.Username)
+		}
+		byUser[ev.Username] = append(byUser[ev.Username], ev)
+	}
+
+	for _, username := range order {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, ev := range byUser[username] {
+			err := enc.Encode(ev)
+			if err != nil {
+				return fmt.Errorf("could not encode event: %v", err)
+			}
+		}
+
+		f, err := os.OpenFile(s.eventsPath(username), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("could not open event log: %v", err)
+		}
+		_, err = f.Write(buf.Bytes())
+		if err == nil {
+			err = f.Sync()
+		}
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("could not write event log: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) Events(username string, after int) ([]gamelogic.Event, error) {
+	f, err := os.Open(s.eventsPath(username))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read event log: %v", err)
+	}
+	defer f.Close()
+
+	events := []gamelogic.Event{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var ev gamelogic.Event
+		err = json.Unmarshal(scanner.Bytes(), &ev)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode event: %v", err)
+		}
+		if ev.Seq > after {
+			events = append(events, ev)
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("could not read event log: %v", err)
+	}
+	return events, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// LogIndex keeps a copy of every game log in a SQLite database so that logs
+// can be searched by player, time and text.
+type LogIndex struct {
+	db *sql.DB
+}
+
+// NewLogIndex opens (or creates) the index at path.
+func NewLogIndex(path string) (*LogIndex, error) {
+	// Several servers may share the index, so wait for each other's writes
+	// instead of failing.
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("could not open log index: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS game_logs (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		at       TIMESTAMP NOT NULL,
+		message  TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS game_logs_username ON game_logs (username, at);
+	CREATE INDEX IF NOT EXISTS game_logs_at ON game_logs (at)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create log table: %v", err)
+	}
+	return &LogIndex{
+		db: db,
+	}, nil
+}
+
+// Add indexes gamelogs in a single transaction.
+func (idx *LogIndex) Add(gamelogs []routing.GameLog) error {
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not index logs: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, gamelog := range gamelogs {
+		_, err = tx.Exec(
+			`INSERT INTO game_logs (username, at, message) VALUES (?, ?, ?)`,
+			gamelog.Username, gamelog.CurrentTime.UTC(), gamelog.Message,
+		)
+		if err != nil {
+			return fmt.Errorf("could not index log: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("could not index logs: %v", err)
+	}
+	return nil
+}
+
+// ByUser returns the latest limit logs of username, oldest first.
+func (idx *LogIndex) ByUser(username string, limit int) ([]routing.GameLog, error) {
+	return idx.query(`WHERE username = ?`, limit, username)
+}
+
+// Since returns the latest limit logs written at or after t, oldest first.
+func (idx *LogIndex) Since(t time.Time, limit int) ([]routing.GameLog, error) {
+	return idx.query(`WHERE at >= ?`, limit, t.UTC())
+}
+
+// Grep returns the latest limit logs whose message contains text, ignoring
+// case, oldest first.
+func (idx *LogIndex) Grep(text string, limit int) ([]routing.GameLog, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+	return idx.query(`WHERE message LIKE ? ESCAPE '\'`, limit, "%"+escaped+"%")
+}
+
+func (idx *LogIndex) query(where string, limit int, args ...any) ([]routing.GameLog, error) {
+	rows, err := idx.db.Query(
+		`SELECT username, at, message FROM (
+			SELECT id, username, at, message FROM game_logs `+where+`
+			ORDER BY at DESC, id DESC LIMIT ?
+		) ORDER BY at, id`,
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not query logs: %v", err)
+	}
+	defer rows.Close()
+
+	gamelogs := []routing.GameLog{}
+	for rows.Next() {
+		var gamelog routing.GameLog
+		err = rows.Scan(&gamelog.Username, &gamelog.CurrentTime, &gamelog.Message)
+		if err != nil {
+			return nil, fmt.Errorf("could not read log: %v", err)
+		}
+		gamelogs = append(gamelogs, gamelog)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("could not query logs: %v", err)
+	}
+	return gamelogs, nil
+}
+
+func (idx *LogIndex) Close() error {
+	return idx.db.Close()
+}
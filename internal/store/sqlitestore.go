@@ -0,0 +1,163 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore keeps snapshots and events as JSON in a SQLite database. Rows
+// are keyed by namespace and username so that one database can hold every
+// room.
+type SQLiteStore struct {
+	db        *sql.DB
+	namespace string
+}
+
+// NewSQLiteStore opens (or creates) the database at path.
+func NewSQLiteStore(path, namespace string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open state database: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS game_states (
+		namespace TEXT NOT NULL,
+		username  TEXT NOT NULL,
+		snapshot  TEXT NOT NULL,
+		saved_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (namespace, username)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create state table: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS game_events (
+		namespace TEXT NOT NULL,
+		username  TEXT NOT NULL,
+		seq       INTEGER NOT NULL,
+		kind      TEXT NOT NULL,
+		event     TEXT NOT NULL,
+		at        TIMESTAMP NOT NULL,
+		PRIMARY KEY (namespace, username, seq)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create event table: %v", err)
+	}
+	return &SQLiteStore{
+		db:        db,
+		namespace: namespace,
+	}, nil
+}
+
+func (s *SQLiteStore) Load(username string) (gamelogic.GameSnapshot, bool, error) {
+	var data string
+	err := s.db.QueryRow(
+		`SELECT snapshot FROM game_states WHERE namespace = ? AND username = ?`,
+		s.namespace, username,
+	).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return gamelogic.GameSnapshot{}, false, nil
+	}
+	if err != nil {
+		return gamelogic.GameSnapshot{}, false, fmt.Errorf("could not read snapshot: %v", err)
+	}
+
+	var snapshot gamelogic.GameSnapshot
+	err = json.Unmarshal([]byte(data), &snapshot)
+	if err != nil {
+		return gamelogic.GameSnapshot{}, false, fmt.Errorf("could not decode snapshot: %v", err)
+	}
+	return snapshot, true, nil
+}
+
+func (s *SQLiteStore) Save(snapshot gamelogic.GameSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %v", err)
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO game_states (namespace, username, snapshot, saved_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (namespace, username) DO UPDATE SET
+			snapshot = excluded.snapshot,
+			saved_at = excluded.saved_at`,
+		s.namespace, snapshot.Player.Username, string(data),
+	)
+	if err != nil {
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	return nil
+}
+
+// Append inserts the events in a single transaction.
+func (s *SQLiteStore) Append(events []gamelogic.Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not write events: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, ev := range events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return fmt.Errorf("could not encode event: %v", err)
+		}
+		_, err = tx.Exec(
+			`INSERT INTO game_events (namespace, username, seq, kind, event, at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			s.namespace, ev.Username, ev.Seq, string(ev.Kind), string(data), ev.At,
+		)
+		if err != nil {
+			return fmt.Errorf("could not write event: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("could not write events: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Events(username string, after int) ([]gamelogic.Event, error) {
+	rows, err := s.db.Query(
+		`SELECT event FROM game_events
+		WHERE namespace = ? AND username = ? AND seq > ?
+		ORDER BY seq`,
+		s.namespace, username, after,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not read events: %v", err)
+	}
+	defer rows.Close()
+
+	events := []gamelogic.Event{}
+	for rows.Next() {
+		var data string
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, fmt.Errorf("could not read event: %v", err)
+		}
+		var ev gamelogic.Event
+		err = json.Unmarshal([]byte(data), &ev)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode event: %v", err)
+		}
+		events = append(events, ev)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("could not read events: %v", err)
+	}
+	return events, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
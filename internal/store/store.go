@@ -0,0 +1,47 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// Default locations used when no path is given.
+const (
+	defaultStateDir = "peril_state"
+	defaultStateDB  = "peril_state.db"
+)
+
+// Open returns the state store of the given kind for a room. An empty kind
+// or "none" disables persistence. path is a directory for file stores and a
+// database file for SQLite; the defaults are used when it is empty.
+func Open(kind, path, room string) (gamelogic.StateStore, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+
+	case "json", "gob":
+		if path == "" {
+			path = defaultStateDir
+		}
+		s, err := NewFileStore(filepath.Join(path, room), FileFormat(kind))
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+
+	case "sqlite":
+		if path == "" {
+			path = defaultStateDB
+		}
+		s, err := NewSQLiteStore(path, room)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+
+	default:
+		return nil, fmt.Errorf("unknown state store %q: use none, json, gob or sqlite", kind)
+	}
+}
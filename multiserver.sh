@@ -23,9 +23,11 @@ cleanup() {
 # Setup trap for SIGINT
 trap 'cleanup' SIGINT
 
-# Start the specified number of instances of the program in the background
+# Start the specified number of instances of the program in the background.
+# Each instance appends to, rotates and prunes its own game log, so that no
+# instance removes a file another one is still writing to.
 for (( i=0; i<num_instances; i++ )); do
-  go run ./cmd/server &
+  go run ./cmd/server -log-path "game.$i.log" &
   pids+=($!)
 done
 
@@ -12,6 +12,28 @@ start_or_run () {
     fi
 }
 
+# add_user creates a broker user for a player. Players may declare and use
+# their own queues and publish to any exchange, but may not read or bind to the
+# login exchange or consume the login queue, so no player can see another's
+# login request. The broker also checks that a player only publishes with
+# their own user ID. On the topic exchange, players may only publish under
+# their own name, except to address a whisper or diplomacy message, and may
+# only bind to what is addressed to them, so armies out of sight stay hidden.
+add_user () {
+    if [ -z "$2" ] || [ -z "$3" ]; then
+        echo "Usage: $0 adduser <player> <password>"
+        exit 1
+    fi
+    docker exec peril_rabbitmq rabbitmqctl add_user "$2" "$3"
+    docker exec peril_rabbitmq rabbitmqctl set_permissions -p / "$2" \
+        '^(?!login$|peril_).*' \
+        '^(?!login$).*' \
+        '^(?!login$|peril_login$).*'
+    docker exec peril_rabbitmq rabbitmqctl set_topic_permissions -p / "$2" peril_topic \
+        '^[a-z0-9_-]+\.((army_moves|army_spawns|army_orders|war|game_logs|world_map_request|chat\.broadcast)\.{username}|(diplomacy|chat\.whisper)\.[A-Za-z0-9_-]+)$' \
+        '^[a-z0-9_-]+\.((army_moves_visible|army_spawns_visible|spawn_rejected|round_result|diplomacy|chat\.whisper)\.{username}|(war|chat\.broadcast)\.\*)$'
+}
+
 case "$1" in
     start)
         start_or_run
@@ -24,7 +46,10 @@ case "$1" in
         echo "Fetching logs for Peril RabbitMQ container..."
         docker logs -f peril_rabbitmq
         ;;
+    adduser)
+        add_user "$@"
+        ;;
     *)
-        echo "Usage: $0 {start|stop|logs}"
+        echo "Usage: $0 {start|stop|logs|adduser <player> <password>}"
         exit 1
 esac